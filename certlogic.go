@@ -0,0 +1,463 @@
+package mobilecore
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CertLogic is the subset of JsonLogic that is used by the EU gateway to distribute business rules.
+// The expressions and data are the result of JSON unmarshalling into an interface{}, so numbers are
+// float64 values. Dates only exist during evaluation, as the result of plusTime or dccDateOfBirth.
+
+var (
+	CERTLOGIC_DATE_REGEX            = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+	CERTLOGIC_PARTIAL_DATE_REGEX    = regexp.MustCompile(`^(\d{4})(?:-(\d{2}))?$`)
+	CERTLOGIC_DATE_TIME_TZ_REGEX    = regexp.MustCompile(`([+-]\d{2})(\d{2})$`)
+	CERTLOGIC_DATE_TIME_NO_TZ_REGEX = regexp.MustCompile(`T\d{2}:\d{2}(:\d{2}(\.\d+)?)?$`)
+)
+
+func evaluateCertLogic(expr interface{}, data interface{}) (interface{}, error) {
+	switch expr := expr.(type) {
+	case nil, string, bool:
+		return expr, nil
+
+	case float64:
+		if !isCertLogicInteger(expr) {
+			return nil, errors.Errorf("Only integer numbers are supported, got %v", expr)
+		}
+
+		return expr, nil
+
+	case []interface{}:
+		values := make([]interface{}, 0, len(expr))
+		for _, item := range expr {
+			value, err := evaluateCertLogic(item, data)
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, value)
+		}
+
+		return values, nil
+
+	case map[string]interface{}:
+		if len(expr) != 1 {
+			return nil, errors.Errorf("An operation should have exactly one operator, got %d", len(expr))
+		}
+
+		for operator, operandsExpr := range expr {
+			return evaluateCertLogicOperation(operator, operandsExpr, data)
+		}
+	}
+
+	return nil, errors.Errorf("Unsupported expression of type %T", expr)
+}
+
+func evaluateCertLogicOperation(operator string, operandsExpr interface{}, data interface{}) (interface{}, error) {
+	if operator == "var" {
+		path, ok := operandsExpr.(string)
+		if !ok {
+			return nil, errors.Errorf("The operand of var should be a string")
+		}
+
+		return evaluateCertLogicVar(path, data), nil
+	}
+
+	operands, ok := operandsExpr.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("The operands of %s should be an array", operator)
+	}
+
+	switch operator {
+	case "if":
+		if len(operands) != 3 {
+			return nil, errors.Errorf("The if operation should have exactly three operands")
+		}
+
+		guard, err := evaluateCertLogic(operands[0], data)
+		if err != nil {
+			return nil, err
+		}
+
+		if isCertLogicTruthy(guard) {
+			return evaluateCertLogic(operands[1], data)
+		}
+
+		return evaluateCertLogic(operands[2], data)
+
+	case "and":
+		if len(operands) < 2 {
+			return nil, errors.Errorf("The and operation should have at least two operands")
+		}
+
+		var value interface{}
+		for _, operand := range operands {
+			var err error
+			value, err = evaluateCertLogic(operand, data)
+			if err != nil {
+				return nil, err
+			}
+
+			if !isCertLogicTruthy(value) {
+				return value, nil
+			}
+		}
+
+		return value, nil
+
+	case "reduce":
+		return evaluateCertLogicReduce(operands, data)
+	}
+
+	// All other operations evaluate all of their operands first
+	values := make([]interface{}, 0, len(operands))
+	for _, operand := range operands {
+		value, err := evaluateCertLogic(operand, data)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, value)
+	}
+
+	switch operator {
+	case "!":
+		if len(values) != 1 {
+			return nil, errors.Errorf("The ! operation should have exactly one operand")
+		}
+
+		return !isCertLogicTruthy(values[0]), nil
+
+	case "===":
+		if len(values) != 2 {
+			return nil, errors.Errorf("The === operation should have exactly two operands")
+		}
+
+		return isCertLogicEqual(values[0], values[1]), nil
+
+	case "in":
+		if len(values) != 2 {
+			return nil, errors.Errorf("The in operation should have exactly two operands")
+		}
+
+		list, ok := values[1].([]interface{})
+		if !ok {
+			return nil, errors.Errorf("The second operand of in should be an array")
+		}
+
+		for _, item := range list {
+			if isCertLogicEqual(values[0], item) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+
+	case "+":
+		sum := 0.0
+		for _, value := range values {
+			number, ok := value.(float64)
+			if !ok {
+				return nil, errors.Errorf("The operands of + should be integers")
+			}
+
+			sum += number
+		}
+
+		return sum, nil
+
+	case "<", ">", "<=", ">=":
+		return evaluateCertLogicComparison(operator, values, func(value interface{}) (float64, bool) {
+			number, ok := value.(float64)
+			return number, ok
+		})
+
+	case "before", "after", "not-before", "not-after":
+		comparisonOperator := map[string]string{"before": "<", "after": ">", "not-before": ">=", "not-after": "<="}[operator]
+		return evaluateCertLogicComparison(comparisonOperator, values, func(value interface{}) (float64, bool) {
+			date, ok := value.(time.Time)
+			return float64(date.Unix()), ok
+		})
+
+	case "plusTime":
+		return evaluateCertLogicPlusTime(values)
+
+	case "dccDateOfBirth":
+		if len(values) != 1 {
+			return nil, errors.Errorf("The dccDateOfBirth operation should have exactly one operand")
+		}
+
+		dob, ok := values[0].(string)
+		if !ok {
+			return nil, errors.Errorf("The operand of dccDateOfBirth should be a string")
+		}
+
+		return parseCertLogicDateOfBirth(dob)
+
+	case "extractFromUVCI":
+		return evaluateCertLogicExtractFromUVCI(values)
+	}
+
+	return nil, errors.Errorf("Unsupported operator %s", operator)
+}
+
+func evaluateCertLogicVar(path string, data interface{}) interface{} {
+	if path == "" {
+		return data
+	}
+
+	value := data
+	for _, fragment := range strings.Split(path, ".") {
+		switch current := value.(type) {
+		case map[string]interface{}:
+			value = current[fragment]
+
+		case []interface{}:
+			var index int
+			_, err := fmt.Sscanf(fragment, "%d", &index)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil
+			}
+
+			value = current[index]
+
+		default:
+			return nil
+		}
+	}
+
+	return value
+}
+
+func evaluateCertLogicReduce(operands []interface{}, data interface{}) (interface{}, error) {
+	if len(operands) != 3 {
+		return nil, errors.Errorf("The reduce operation should have exactly three operands")
+	}
+
+	operand, err := evaluateCertLogic(operands[0], data)
+	if err != nil {
+		return nil, err
+	}
+
+	accumulator, err := evaluateCertLogic(operands[2], data)
+	if err != nil {
+		return nil, err
+	}
+
+	if operand == nil {
+		return accumulator, nil
+	}
+
+	list, ok := operand.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("The first operand of reduce should be an array or null")
+	}
+
+	for _, item := range list {
+		accumulator, err = evaluateCertLogic(operands[1], map[string]interface{}{
+			"current":     item,
+			"accumulator": accumulator,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return accumulator, nil
+}
+
+func evaluateCertLogicComparison(operator string, values []interface{}, toNumber func(interface{}) (float64, bool)) (interface{}, error) {
+	if len(values) != 2 && !(len(values) == 3 && (operator == "<" || operator == "<=")) {
+		return nil, errors.Errorf("Invalid amount of operands for comparison %s", operator)
+	}
+
+	numbers := make([]float64, 0, len(values))
+	for _, value := range values {
+		number, ok := toNumber(value)
+		if !ok {
+			return nil, errors.Errorf("Invalid operand type %T for comparison %s", value, operator)
+		}
+
+		numbers = append(numbers, number)
+	}
+
+	compare := func(a, b float64) bool {
+		switch operator {
+		case "<":
+			return a < b
+		case ">":
+			return a > b
+		case "<=":
+			return a <= b
+		default:
+			return a >= b
+		}
+	}
+
+	for i := 0; i < len(numbers)-1; i++ {
+		if !compare(numbers[i], numbers[i+1]) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func evaluateCertLogicPlusTime(values []interface{}) (interface{}, error) {
+	if len(values) != 3 {
+		return nil, errors.Errorf("The plusTime operation should have exactly three operands")
+	}
+
+	amount, ok := values[1].(float64)
+	if !ok || !isCertLogicInteger(amount) {
+		return nil, errors.Errorf("The second operand of plusTime should be an integer")
+	}
+
+	// The date is either a string, or the result of dccDateOfBirth
+	var date time.Time
+	switch value := values[0].(type) {
+	case string:
+		var err error
+		date, err = parseCertLogicDateTime(value)
+		if err != nil {
+			return nil, err
+		}
+
+	case time.Time:
+		date = value
+
+	default:
+		return nil, errors.Errorf("The first operand of plusTime should be a string or date")
+	}
+
+	switch values[2] {
+	case "year":
+		return date.AddDate(int(amount), 0, 0), nil
+	case "month":
+		return date.AddDate(0, int(amount), 0), nil
+	case "day":
+		return date.AddDate(0, 0, int(amount)), nil
+	case "hour":
+		return date.Add(time.Duration(amount) * time.Hour), nil
+	}
+
+	return nil, errors.Errorf("Unsupported plusTime unit %v", values[2])
+}
+
+func evaluateCertLogicExtractFromUVCI(values []interface{}) (interface{}, error) {
+	if len(values) != 2 {
+		return nil, errors.Errorf("The extractFromUVCI operation should have exactly two operands")
+	}
+
+	index, ok := values[1].(float64)
+	if !ok || !isCertLogicInteger(index) {
+		return nil, errors.Errorf("The second operand of extractFromUVCI should be an integer")
+	}
+
+	if values[0] == nil {
+		return nil, nil
+	}
+
+	uvci, ok := values[0].(string)
+	if !ok {
+		return nil, errors.Errorf("The first operand of extractFromUVCI should be a string or null")
+	}
+
+	uvci = strings.TrimPrefix(uvci, "URN:UVCI:")
+	fragments := strings.FieldsFunc(uvci, func(r rune) bool {
+		return r == '/' || r == '#' || r == ':'
+	})
+
+	if index < 0 || int(index) >= len(fragments) {
+		return nil, nil
+	}
+
+	return fragments[int(index)], nil
+}
+
+// parseCertLogicDateTime parses a date or date-time. A date is interpreted as midnight UTC,
+// and a date-time without time zone as UTC.
+func parseCertLogicDateTime(value string) (time.Time, error) {
+	if CERTLOGIC_DATE_REGEX.MatchString(value) {
+		return time.Parse(YYYYMMDD_FORMAT, value)
+	}
+
+	// Normalize time zones without a colon, and add a missing time zone
+	normalized := CERTLOGIC_DATE_TIME_TZ_REGEX.ReplaceAllString(value, "$1:$2")
+	if CERTLOGIC_DATE_TIME_NO_TZ_REGEX.MatchString(normalized) {
+		normalized += "Z"
+	}
+
+	date, err := time.Parse(time.RFC3339Nano, normalized)
+	if err != nil {
+		date, err = time.Parse("2006-01-02T15:04Z07:00", normalized)
+		if err != nil {
+			return time.Time{}, errors.Errorf("Could not parse date-time '%s'", value)
+		}
+	}
+
+	return date, nil
+}
+
+// parseCertLogicDateOfBirth parses a (partial) date of birth, where a missing month or day
+// is interpreted as the last possible day, so that the person has certainly reached an age
+func parseCertLogicDateOfBirth(value string) (time.Time, error) {
+	if CERTLOGIC_DATE_REGEX.MatchString(value) {
+		return time.Parse(YYYYMMDD_FORMAT, value)
+	}
+
+	matches := CERTLOGIC_PARTIAL_DATE_REGEX.FindStringSubmatch(value)
+	if matches == nil {
+		return time.Time{}, errors.Errorf("Could not parse date of birth '%s'", value)
+	}
+
+	var year, month int
+	_, _ = fmt.Sscanf(matches[1], "%d", &year)
+	month = 12
+	if matches[2] != "" {
+		_, _ = fmt.Sscanf(matches[2], "%d", &month)
+	}
+
+	// The last day of the month is the day before the first day of the next month
+	return time.Date(year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC), nil
+}
+
+func isCertLogicTruthy(value interface{}) bool {
+	switch value := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return value
+	case float64:
+		return value != 0
+	case string:
+		return value != ""
+	case []interface{}:
+		return len(value) != 0
+	case map[string]interface{}:
+		return len(value) != 0
+	}
+
+	return true
+}
+
+func isCertLogicEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil, bool, float64, string:
+		return a == b
+	case time.Time:
+		date, ok := b.(time.Time)
+		return ok && a.Equal(date)
+	}
+
+	return false
+}
+
+func isCertLogicInteger(number float64) bool {
+	return number == math.Trunc(number)
+}
@@ -0,0 +1,274 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCertLogic(t *testing.T) {
+	data := map[string]interface{}{}
+	err := json.Unmarshal([]byte(`{
+		"payload": {
+			"dob": "1990-03",
+			"v": [{"dn": 2, "sd": 2, "dt": "2021-06-08", "mp": "EU/1/20/1507", "ci": "URN:UVCI:01:NL:ABC/42#S"}]
+		},
+		"external": {
+			"validationClock": "2021-07-01T12:00:00Z",
+			"valueSets": {"vaccines": ["EU/1/20/1507", "EU/1/20/1528"]}
+		}
+	}`), &data)
+	if err != nil {
+		t.Fatal("Could not unmarshal data", err)
+	}
+
+	testCases := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`{"var": "payload.v.0.dn"}`, 2.0},
+		{`{"var": "payload.v.1.dn"}`, nil},
+		{`{"var": "payload.r.0.fr"}`, nil},
+		{`{"===": [{"var": "payload.v.0.mp"}, "EU/1/20/1507"]}`, true},
+		{`{"===": [2, "2"]}`, false},
+		{`{"and": [true, 0, true]}`, 0.0},
+		{`{"and": [{"var": "payload.v"}, "last"]}`, "last"},
+		{`{"if": [{"var": "payload.r"}, "recovery", "other"]}`, "other"},
+		{`{"!": [[]]}`, true},
+		{`{">=": [{"var": "payload.v.0.dn"}, {"var": "payload.v.0.sd"}]}`, true},
+		{`{"<": [1, {"var": "payload.v.0.dn"}, 3]}`, true},
+		{`{"<=": [1, 3, 2]}`, false},
+		{`{"+": [1, 2, 3]}`, 6.0},
+		{`{"in": [{"var": "payload.v.0.mp"}, {"var": "external.valueSets.vaccines"}]}`, true},
+		{`{"in": ["EU/1/21/1529", {"var": "external.valueSets.vaccines"}]}`, false},
+		{`{"reduce": [{"var": "payload.v"}, {"+": [{"var": "accumulator"}, {"var": "current.dn"}]}, 1]}`, 3.0},
+		{`{"reduce": [{"var": "payload.t"}, {"var": "current"}, "initial"]}`, "initial"},
+		{`{"extractFromUVCI": [{"var": "payload.v.0.ci"}, 1]}`, "NL"},
+		{`{"extractFromUVCI": [{"var": "payload.v.0.ci"}, 3]}`, "42"},
+		{`{"extractFromUVCI": [{"var": "payload.v.0.ci"}, 5]}`, nil},
+		{`{"extractFromUVCI": [null, 0]}`, nil},
+
+		// Dates
+		{`{"not-before": [{"plusTime": [{"var": "external.validationClock"}, 0, "day"]}, {"plusTime": [{"var": "payload.v.0.dt"}, 14, "day"]}]}`, true},
+		{`{"before": [{"plusTime": [{"var": "external.validationClock"}, 0, "day"]}, {"plusTime": [{"var": "payload.v.0.dt"}, 1, "month"]}]}`, true},
+		{`{"after": [{"plusTime": ["2021-07-01T13:00:00+0200", 0, "hour"]}, {"plusTime": [{"var": "external.validationClock"}, -2, "hour"]}]}`, true},
+		{`{"not-after": [{"plusTime": ["2021-06-08", 0, "day"]}, {"plusTime": ["2021-06-08T00:00:00Z", 0, "day"]}, {"plusTime": ["2021-06-09", 0, "day"]}]}`, true},
+		{`{"after": [{"plusTime": [{"var": "external.validationClock"}, 0, "day"]}, {"plusTime": [{"dccDateOfBirth": [{"var": "payload.dob"}]}, 31, "year"]}]}`, true},
+		{`{"===": [{"plusTime": ["2021-01-31", 1, "year"]}, {"plusTime": ["2022-01-31T00:00:00", 0, "day"]}]}`, true},
+	}
+
+	for i, testCase := range testCases {
+		var expr interface{}
+		err := json.Unmarshal([]byte(testCase.expr), &expr)
+		if err != nil {
+			t.Fatal("Could not unmarshal expression of test case", i, err)
+		}
+
+		value, err := evaluateCertLogic(expr, data)
+		if err != nil {
+			t.Fatal("Could not evaluate test case", i, err)
+		}
+
+		if value != testCase.expected {
+			t.Fatal("Expected", testCase.expected, "for test case", i, "but got", value)
+		}
+	}
+
+	invalidExprs := []string{
+		`{"unknown": [1]}`,
+		`{"var": 1}`,
+		`{"and": [true]}`,
+		`{"if": [true, 1]}`,
+		`{"+": [1, "2"]}`,
+		`{"<": [1, 2, 3, 4]}`,
+		`{">": [1, 2, 3]}`,
+		`{"before": ["2021-01-01", "2021-01-02"]}`,
+		`{"plusTime": ["2021-01-01", 1, "week"]}`,
+		`{"plusTime": ["not a date", 1, "day"]}`,
+		`{"in": [1, 2]}`,
+		`1.5`,
+		`{"===": [1, 2], "!": [1]}`,
+	}
+
+	for i, invalidExpr := range invalidExprs {
+		var expr interface{}
+		err := json.Unmarshal([]byte(invalidExpr), &expr)
+		if err != nil {
+			t.Fatal("Could not unmarshal invalid expression", i, err)
+		}
+
+		_, err = evaluateCertLogic(expr, data)
+		if err == nil {
+			t.Fatal("Expected an error for invalid expression", i)
+		}
+	}
+}
+
+func TestBusinessRules(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	// Without business rules, the built-in rules are reported
+	v, err := NewVerifier(configJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	ruleResults, err := v.EvaluateEuropeanRules(defaultQR, "NL", now)
+	if err != nil {
+		t.Fatal("Could not evaluate rules", err)
+	}
+
+	if len(ruleResults) != 1 || ruleResults[0].Identifier != GO_RULE_VACCINATION || ruleResults[0].Result != BUSINESS_RULE_RESULT_PASSED {
+		t.Fatal("Expected the built-in vaccination rule to pass")
+	}
+
+	// The vaccination of the default QR is valid from 2021-07-24, so a delay of 21 days fails
+	businessRulesJson := `"businessRules": [
+		` + testBusinessRuleJson("VR-NL-0001", "Vaccination", `{">=": [{"var": "payload.v.0.dn"}, {"var": "payload.v.0.sd"}]}`) + `,
+		` + testBusinessRuleJson("VR-NL-0002", "Vaccination", `{"not-before": [{"plusTime": [{"var": "external.validationClock"}, 0, "day"]}, {"plusTime": [{"var": "payload.v.0.dt"}, 21, "day"]}]}`) + `,
+		` + testBusinessRuleJson("VR-NL-0003", "Vaccination", `{"in": [{"var": "payload.v.0.mp"}, {"var": "external.valueSets.vaccines"}]}`) + `,
+		` + testBusinessRuleJson("TR-NL-0001", "Test", `{"var": "payload.t.0.tr"}`) + `,
+		` + testBusinessRuleJson("GR-NL-0001", "General", `{"plusTime": [{"var": "payload.unknown"}, 0, "day"]}`) + `
+	],
+	"businessRuleValueSets": {"vaccines": ["EU/1/20/1528"]},
+	"recoveryValidFromDays": 11,`
+	rulesConfigJson := []byte(strings.Replace(string(configJson), `"recoveryValidFromDays": 11,`, businessRulesJson, 1))
+
+	err = v.UpdateConfig(rulesConfigJson)
+	if err != nil {
+		t.Fatal("Could not update config with business rules", err)
+	}
+
+	ruleResults, err = v.EvaluateEuropeanRules(defaultQR, "NL", now)
+	if err != nil {
+		t.Fatal("Could not evaluate business rules", err)
+	}
+
+	expectedResults := map[string]string{
+		"VR-NL-0001": BUSINESS_RULE_RESULT_PASSED,
+		"VR-NL-0002": BUSINESS_RULE_RESULT_FAILED,
+		"VR-NL-0003": BUSINESS_RULE_RESULT_PASSED,
+		"GR-NL-0001": BUSINESS_RULE_RESULT_OPEN,
+	}
+
+	if len(ruleResults) != len(expectedResults) {
+		t.Fatal("Expected", len(expectedResults), "rule results, got", len(ruleResults))
+	}
+
+	for _, ruleResult := range ruleResults {
+		if ruleResult.Result != expectedResults[ruleResult.Identifier] {
+			t.Fatal("Unexpected result", ruleResult.Result, "for rule", ruleResult.Identifier)
+		}
+	}
+
+	if ruleResults[1].Message != "Test description of VR-NL-0002" {
+		t.Fatal("Expected the description of the failed rule as message")
+	}
+
+	// Countries of arrival without rules in the config are unknown
+	_, err = v.EvaluateEuropeanRules(defaultQR, "DE", now)
+	if getVerificationFailure(err).Reason != FAILURE_REASON_UNKNOWN_COUNTRY {
+		t.Fatal("Expected an unknown country failure for another country of arrival", err)
+	}
+
+	// Verification fails on the failed (and open) business rules
+	r1 := v.verify(defaultQR, now)
+	if r1.Status != VERIFICATION_FAILED_ERROR || r1.Failure.Reason != FAILURE_REASON_BUSINESS_RULE_FAILED {
+		t.Fatal("Expected a business rule failure, got", r1.Status, r1.Error)
+	}
+
+	if !strings.Contains(r1.Error, "VR-NL-0002, GR-NL-0001") {
+		t.Fatal("Expected the failed rules in the error, got", r1.Error)
+	}
+
+	// Only the newest version of a rule is evaluated, comparing versions numerically
+	failingRuleJson := testBusinessRuleJson("VR-NL-0002", "Vaccination", `false`)
+	versionedRulesJson := `"businessRules": [
+		` + failingRuleJson + `,
+		` + strings.Replace(testBusinessRuleJson("VR-NL-0002", "Vaccination", `true`), `"1.0.0"`, `"1.10.0"`, 1) + `,
+		` + strings.Replace(failingRuleJson, `"1.0.0"`, `"1.2.0"`, 1) + `
+	],
+	"recoveryValidFromDays": 11,`
+
+	err = v.UpdateConfig([]byte(strings.Replace(string(configJson), `"recoveryValidFromDays": 11,`, versionedRulesJson, 1)))
+	if err != nil {
+		t.Fatal("Could not update config with versioned business rules", err)
+	}
+
+	ruleResults, err = v.EvaluateEuropeanRules(defaultQR, "NL", now)
+	if err != nil || len(ruleResults) != 1 || ruleResults[0].Result != BUSINESS_RULE_RESULT_PASSED {
+		t.Fatal("Expected only the newest version of the rule to be evaluated", err)
+	}
+
+	// A vaccination to which no vaccination rule applies fails
+	testRulesJson := `"businessRules": [
+		` + testBusinessRuleJson("TR-NL-0001", "Test", `true`) + `
+	],
+	"recoveryValidFromDays": 11,`
+
+	err = v.UpdateConfig([]byte(strings.Replace(string(configJson), `"recoveryValidFromDays": 11,`, testRulesJson, 1)))
+	if err != nil {
+		t.Fatal("Could not update config with test business rules", err)
+	}
+
+	r2 := v.verify(defaultQR, now)
+	if r2.Status != VERIFICATION_FAILED_ERROR || r2.Failure.Reason != FAILURE_REASON_BUSINESS_RULE_FAILED || !strings.Contains(r2.Error, MISSING_RULE_VACCINATION) {
+		t.Fatal("Expected a business rule failure without applicable vaccination rule, got", r2.Status, r2.Error)
+	}
+
+	// Invalid business rules are refused
+	invalidRulesConfigJson := []byte(strings.Replace(
+		string(rulesConfigJson),
+		`"Engine": "CERTLOGIC"`, `"Engine": "OTHER"`, 1,
+	))
+
+	issues := validateVerifierConfig(mustUnmarshalVerifierConfig(t, invalidRulesConfigJson))
+	if len(issues) != 1 || issues[0].Field != "europeanVerificationRules.businessRules" {
+		t.Fatal("Expected a single business rules issue")
+	}
+
+	invalidVersionConfigJson := []byte(strings.Replace(string(rulesConfigJson), `"Version": "1.0.0"`, `"Version": "1.0"`, 1))
+	issues = validateVerifierConfig(mustUnmarshalVerifierConfig(t, invalidVersionConfigJson))
+	if len(issues) != 1 || !strings.Contains(issues[0].Message, "version") {
+		t.Fatal("Expected a single business rule version issue")
+	}
+}
+
+func testBusinessRuleJson(identifier, certificateType, logic string) string {
+	return `{
+		"Identifier": "` + identifier + `",
+		"Type": "Acceptance",
+		"Country": "NL",
+		"Version": "1.0.0",
+		"SchemaVersion": "1.0.0",
+		"Engine": "CERTLOGIC",
+		"EngineVersion": "0.7.5",
+		"CertificateType": "` + certificateType + `",
+		"Description": [{"lang": "en", "desc": "Test description of ` + identifier + `"}],
+		"ValidFrom": "2021-07-01T00:00:00Z",
+		"ValidTo": "2030-06-01T00:00:00Z",
+		"AffectedFields": [],
+		"Logic": ` + logic + `
+	}`
+}
+
+func mustUnmarshalVerifierConfig(t *testing.T, configJson []byte) *verifierConfiguration {
+	config, err := unmarshalVerifierConfig(configJson)
+	if err != nil {
+		t.Fatal("Could not unmarshal verifier config", err)
+	}
+
+	return config
+}
@@ -10,6 +10,7 @@ import (
 	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
 	mobilecore "github.com/minvws/nl-covid19-coronacheck-mobile-core"
 	"os"
+	"time"
 )
 
 func main() {
@@ -79,7 +80,7 @@ func runVerify(verifyFlags *flag.FlagSet, configPath *string) error {
 		return errors.Errorf("Config directory '%s' does not exist\n", *configPath)
 	}
 
-	initializeResult := mobilecore.InitializeVerifier(*configPath)
+	initializeResult := mobilecore.InitializeVerifier(*configPath, time.Now().Unix())
 	if initializeResult.Error != "" {
 		return errors.Errorf("Could not initialize verifier: %s\n", initializeResult.Error)
 	}
@@ -108,13 +109,16 @@ func runProofIdentifier(pdFlags *flag.FlagSet, configPath *string) error {
 		return errors.Errorf("Config directory '%s' does not exist\n", *configPath)
 	}
 
-	initializeResult := mobilecore.InitializeVerifier(*configPath)
+	initializeResult := mobilecore.InitializeVerifier(*configPath, time.Now().Unix())
 	if initializeResult.Error != "" {
 		return errors.Errorf("Could not initialize verifier: %s\n", initializeResult.Error)
 	}
 
 	// Get verifier, verify either the domestic or European QR code, and get the proof identifier
-	domesticVerifier, europeanVerifier := mobilecore.GetVerifiersForCLI()
+	domesticVerifier, europeanVerifier, err := mobilecore.GetVerifiersForCLI()
+	if err != nil {
+		return err
+	}
 
 	var proofIdentifier []byte
 	if idemixverifier.HasNLPrefix(qr) {
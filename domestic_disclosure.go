@@ -0,0 +1,253 @@
+package mobilecore
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"github.com/go-errors/errors"
+	"github.com/minvws/base45-go/base45"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
+	"github.com/privacybydesign/gabi"
+	"github.com/privacybydesign/gabi/big"
+	gobig "math/big"
+	"time"
+)
+
+// Selective proofs hide some attributes of a domestic credential. They are prefixed with their own
+// version byte, as the v2 proofs of the idemix library always disclose every attribute.
+const SELECTIVE_PROOF_VERSION_BYTE byte = 'S'
+
+// Only the identifying attributes can be hidden, as the validity attributes are needed to verify
+var hideableDomesticAttributes = map[string]bool{
+	"firstNameInitial": true,
+	"lastNameInitial":  true,
+	"birthDay":         true,
+	"birthMonth":       true,
+}
+
+// selectiveProofSerialization is the v2 proof serialization of the idemix library, together with
+// the credential indices of the hidden attributes. The attribute responses start with the response
+// for the holder secret key, followed by those of the hidden attributes. The disclosed attributes
+// start with the metadata attribute, followed by the others in order of their index.
+type selectiveProofSerialization struct {
+	DisclosureTimeSeconds int64
+	C                     *gobig.Int
+	A                     *gobig.Int
+	EResponse             *gobig.Int
+	VResponse             *gobig.Int
+	HiddenIndices         []int
+	AResponses            []*gobig.Int
+	ADisclosed            []*gobig.Int
+}
+
+func isSelectiveProof(proofPrefixed []byte) bool {
+	return len(proofPrefixed) >= 4 &&
+		proofPrefixed[0] == 'N' && proofPrefixed[1] == 'L' &&
+		proofPrefixed[2] == SELECTIVE_PROOF_VERSION_BYTE && proofPrefixed[3] == ':'
+}
+
+// discloseSelectivelyQREncoded discloses all attributes of the credential, except for the given
+// hidden attributes, with the time as challenge
+func discloseSelectivelyQREncoded(findIssuerPk idemixcommon.FindIssuerPkFunc, holderSk *big.Int, cred *gabi.Credential, hiddenAttributes []string, now time.Time) ([]byte, error) {
+	attributesAmount := len(cred.Attributes)
+	if attributesAmount < 2 {
+		return nil, errors.Errorf("Invalid amount of credential attributes")
+	}
+
+	_, issuerPkId, attributeTypes, err := idemixcommon.DecodeMetadataAttribute(cred.Attributes[1])
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not decode credential metadata", 0)
+	}
+
+	if len(attributeTypes)+2 != attributesAmount {
+		return nil, errors.Errorf("Invalid amount of credential attributes for the metadata")
+	}
+
+	cred.Pk, err = findIssuerPk(issuerPkId)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the holderSk as first attribute of the credential
+	cred.Attributes[0] = holderSk
+
+	hidden := map[string]bool{}
+	for _, hiddenAttribute := range hiddenAttributes {
+		hidden[hiddenAttribute] = true
+	}
+
+	// The metadata attribute is always disclosed
+	disclosedIndices := []int{1}
+	hiddenIndices := []int{}
+	for i, attributeType := range attributeTypes {
+		if hidden[attributeType] {
+			hiddenIndices = append(hiddenIndices, i+2)
+		} else {
+			disclosedIndices = append(disclosedIndices, i+2)
+		}
+	}
+
+	disclosureTimeSeconds := now.Unix()
+	challenge := idemixcommon.CalculateTimeBasedChallenge(disclosureTimeSeconds)
+
+	dpb, err := cred.CreateDisclosureProofBuilder(disclosedIndices, false)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Failed to create disclosure proof builder", 0)
+	}
+
+	proofList := gabi.ProofBuilderList{dpb}.BuildProofList(idemixcommon.BigOne, challenge, false)
+	if len(proofList) != 1 {
+		return nil, errors.Errorf("Invalid amount of proofs")
+	}
+
+	proof := proofList[0].(*gabi.ProofD)
+
+	ps := selectiveProofSerialization{
+		DisclosureTimeSeconds: disclosureTimeSeconds,
+		C:                     proof.C.Go(),
+		A:                     proof.A.Go(),
+		EResponse:             proof.EResponse.Go(),
+		VResponse:             proof.VResponse.Go(),
+		HiddenIndices:         hiddenIndices,
+		AResponses:            []*gobig.Int{proof.AResponses[0].Go()},
+	}
+
+	for _, i := range hiddenIndices {
+		ps.AResponses = append(ps.AResponses, proof.AResponses[i].Go())
+	}
+
+	for _, i := range disclosedIndices {
+		ps.ADisclosed = append(ps.ADisclosed, proof.ADisclosed[i].Go())
+	}
+
+	proofAsn1, err := asn1.Marshal(ps)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not ASN1 marshal proof", 0)
+	}
+
+	proofBase45, err := base45.Base45Encode(proofAsn1)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not base45 encode proof", 0)
+	}
+
+	prefix := []byte{'N', 'L', SELECTIVE_PROOF_VERSION_BYTE, ':'}
+	return append(prefix, proofBase45...), nil
+}
+
+// verifySelectiveQREncoded verifies a selective proof like the idemix verifier verifies a v2 proof,
+// and additionally returns the names of the hidden attributes in order of their index
+func verifySelectiveQREncoded(findIssuerPk idemixcommon.FindIssuerPkFunc, proofPrefixed []byte) (verifiedCred *idemixverifier.VerifiedCredential, hiddenAttributes []string, err error) {
+	if !isSelectiveProof(proofPrefixed) {
+		return nil, nil, errors.Errorf("QR is not prefixed as a selective proof")
+	}
+
+	proofAsn1, err := base45.Base45Decode(proofPrefixed[4:])
+	if err != nil {
+		return nil, nil, errors.Errorf("Could not base45 decode selective proof")
+	}
+
+	ps := &selectiveProofSerialization{}
+	_, err = asn1.Unmarshal(proofAsn1, ps)
+	if err != nil {
+		return nil, nil, errors.Errorf("Could not unmarshal selective proof")
+	}
+
+	if len(ps.ADisclosed) < 1 || len(ps.AResponses) != len(ps.HiddenIndices)+1 {
+		return nil, nil, errors.Errorf("Invalid amount of disclosures or responses")
+	}
+
+	metadataAttribute := big.Convert(ps.ADisclosed[0])
+	credentialVersion, issuerPkId, attributeTypes, err := idemixcommon.DecodeMetadataAttribute(metadataAttribute)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issuerPk, err := findIssuerPk(issuerPkId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attributesAmount := len(attributeTypes) + 2
+	if attributesAmount > len(issuerPk.R) {
+		return nil, nil, errors.Errorf("The credential has more attributes than the public key supports")
+	}
+
+	// Every attribute, except for the secret key, is either hidden or disclosed
+	aResponses := map[int]*big.Int{0: big.Convert(ps.AResponses[0])}
+	for i, hiddenIndex := range ps.HiddenIndices {
+		_, isDuplicate := aResponses[hiddenIndex]
+		if hiddenIndex < 2 || hiddenIndex >= attributesAmount || isDuplicate {
+			return nil, nil, errors.Errorf("Invalid hidden attribute index %d", hiddenIndex)
+		}
+
+		aResponses[hiddenIndex] = big.Convert(ps.AResponses[i+1])
+	}
+
+	aDisclosed := map[int]*big.Int{1: metadataAttribute}
+	disclosureIndex := 1
+	for i := 2; i < attributesAmount; i++ {
+		if _, isHidden := aResponses[i]; isHidden {
+			hiddenAttributes = append(hiddenAttributes, attributeTypes[i-2])
+			continue
+		}
+
+		if disclosureIndex >= len(ps.ADisclosed) {
+			return nil, nil, errors.Errorf("Invalid amount of disclosures")
+		}
+
+		aDisclosed[i] = big.Convert(ps.ADisclosed[disclosureIndex])
+		disclosureIndex++
+	}
+
+	if disclosureIndex != len(ps.ADisclosed) {
+		return nil, nil, errors.Errorf("Invalid amount of disclosures")
+	}
+
+	proof := &gabi.ProofD{
+		C:          big.Convert(ps.C),
+		A:          big.Convert(ps.A),
+		EResponse:  big.Convert(ps.EResponse),
+		VResponse:  big.Convert(ps.VResponse),
+		AResponses: aResponses,
+		ADisclosed: aDisclosed,
+	}
+
+	timeBasedChallenge := idemixcommon.CalculateTimeBasedChallenge(ps.DisclosureTimeSeconds)
+	valid := gabi.ProofList{proof}.Verify([]*gabi.PublicKey{issuerPk}, idemixcommon.BigOne, timeBasedChallenge, false, []string{})
+	if !valid {
+		return nil, nil, errors.Errorf("Invalid proof")
+	}
+
+	attributes := make(map[string]string)
+	for i, d := range aDisclosed {
+		// Exclude metadata attribute
+		if i == 1 {
+			continue
+		}
+
+		attributes[attributeTypes[i-2]] = string(idemixcommon.DecodeAttributeInt(d))
+	}
+
+	// The proof identifier is derived like for v2 proofs, so that the same denylists apply
+	proofDigest := sha256.Sum256(proof.C.Bytes())
+
+	verifiedCred = &idemixverifier.VerifiedCredential{
+		Attributes:            attributes,
+		DisclosureTimeSeconds: ps.DisclosureTimeSeconds,
+		IssuerPkId:            issuerPkId,
+		CredentialVersion:     credentialVersion,
+		ProofIdentifier:       proofDigest[:16],
+	}
+
+	return verifiedCred, hiddenAttributes, nil
+}
+
+func checkHiddenAttributes(hiddenAttributes []string) error {
+	for _, hiddenAttribute := range hiddenAttributes {
+		if !hideableDomesticAttributes[hiddenAttribute] {
+			return failuref(FAILURE_REASON_INVALID_ATTRIBUTES, "The %s attribute should not be hidden", hiddenAttribute)
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,24 @@
 package mobilecore
 
 import (
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"github.com/go-errors/errors"
+	"github.com/minvws/base45-go/base45"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	idemixholder "github.com/minvws/nl-covid19-coronacheck-idemix/holder"
 	"github.com/minvws/nl-covid19-coronacheck-idemix/issuer"
 	"github.com/minvws/nl-covid19-coronacheck-idemix/issuer/localsigner"
 	"github.com/privacybydesign/gabi"
 	gabipool "github.com/privacybydesign/gabi/pool"
+	gobig "math/big"
+	mathrand "math/rand"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -19,7 +30,7 @@ func TestInitialization(t *testing.T) {
 	}
 
 	// Initialize verifier with testdata
-	r2 := InitializeVerifier("./testdata")
+	r2 := InitializeVerifier("./testdata", time.Now().Unix())
 	if r2.Error != "" {
 		t.Fatal("Could not initialize verifier:", r2.Error)
 	}
@@ -136,6 +147,18 @@ func TestFlow(t *testing.T) {
 			if *r8.Details != attributesToVerificationDetails(credentialAttributes[i]) {
 				t.Fatal("Credential attributes do not correspond with verification details")
 			}
+
+			if r8.DetailsV2.BirthDay != 20 || r8.DetailsV2.IsSpecimen || r8.DetailsV2.Statement != nil {
+				t.Fatal("Unexpected typed verification details")
+			}
+
+			// The extended details contain the validity window of the credential
+			r9 := VerifyExtended(r7.Value, "", "", "")
+			validFrom, _ := strconv.ParseInt(credentialAttributes[i]["validFrom"], 10, 64)
+			statement := r9.DetailsV2.Statement
+			if statement == nil || statement.ValidFrom != validFrom || statement.ValidUntil != validFrom+40*60*60 {
+				t.Fatal("Expected the validity window of the credential in the extended details")
+			}
 		}
 
 		if i > 2 && (r8.Status != VERIFICATION_FAILED_ERROR || r8.Error == "") {
@@ -144,6 +167,530 @@ func TestFlow(t *testing.T) {
 	}
 }
 
+func TestDiscloseBest(t *testing.T) {
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key:", r1.Error)
+	}
+
+	// The first two credentials are currently valid, of which the second one is valid the longest
+	credentialsAttributes := buildCredentialsAttributes(3)
+	credsJson := issueTestCredentials(t, r1.Value, credentialsAttributes)
+
+	// Reorder the credentials, so that the best one isn't last
+	credentialsJson := []byte("[" + string(credsJson[2]) + "," + string(credsJson[1]) + "," + string(credsJson[0]) + "]")
+	r2 := DiscloseBest(r1.Value, credentialsJson, time.Now().Unix())
+	if r2.Error != "" {
+		t.Fatal("Could not disclose best credential:", r2.Error)
+	}
+
+	var resultValue *DiscloseBestResultValue
+	err := json.Unmarshal(r2.Value, &resultValue)
+	if err != nil {
+		t.Fatal("Could not unmarshal disclose best result:", err)
+	}
+
+	nextValidFrom, _ := strconv.ParseInt(credentialsAttributes[2]["validFrom"], 10, 64)
+	if resultValue.CredentialIndex != 1 || resultValue.NextValidFrom != nextValidFrom {
+		t.Fatal("Expected the second credential to be disclosed, got", resultValue.CredentialIndex)
+	}
+
+	r3 := Verify([]byte(resultValue.Proof))
+	if r3.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify the best credential:", r3.Error)
+	}
+
+	// Only a credential that is not yet valid
+	r4 := DiscloseBest(r1.Value, []byte("["+string(credsJson[2])+"]"), time.Now().Unix())
+	if r4.ErrorCode != ERROR_CODE_CREDENTIAL_EXPIRED {
+		t.Fatal("Expected a credential expired error without valid credentials, got", r4.ErrorCode)
+	}
+
+	r5 := DiscloseBest(r1.Value, []byte(`[{}]`), time.Now().Unix())
+	if r5.ErrorCode != ERROR_CODE_MALFORMED_INPUT {
+		t.Fatal("Expected a malformed input error for an invalid credential, got", r5.ErrorCode)
+	}
+}
+
+func TestPaperProof(t *testing.T) {
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key:", r1.Error)
+	}
+
+	credentialsAttributes := buildCredentialsAttributes(2)
+	credentialsAttributes[0]["isPaperProof"] = "1"
+	credsJson := issueTestCredentials(t, r1.Value, credentialsAttributes)
+
+	// The disclosure time of a paper proof is its valid from, and is exempt from the freshness check
+	r2 := DisclosePaperProof(r1.Value, credsJson[0])
+	if r2.Error != "" {
+		t.Fatal("Could not disclose paper proof:", r2.Error)
+	}
+
+	r3 := Verify(r2.Value)
+	if r3.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify paper proof:", r3.Error)
+	}
+
+	// Only paper proof credentials can be disclosed as paper proof
+	r4 := DisclosePaperProof(r1.Value, credsJson[1])
+	if r4.ErrorCode != ERROR_CODE_MALFORMED_INPUT {
+		t.Fatal("Expected a malformed input error for a regular credential, got", r4.ErrorCode)
+	}
+
+	// Restrict the validity of paper proofs, and deny the disclosed one
+	verifiedCred, err := defaultVerifier.getSnapshot().domesticVerifier.VerifyQREncoded(r2.Value)
+	if err != nil {
+		t.Fatal("Could not verify paper proof:", err)
+	}
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	paperRules := `"qrValidForSeconds": 60,
+    "paperProofMaxValidityHours": 1,
+    "paperProofIdentifierDenylist": {"%s": true},`
+	paperRules = fmt.Sprintf(paperRules, base64.StdEncoding.EncodeToString(verifiedCred.ProofIdentifier))
+	paperConfigJson := []byte(strings.Replace(string(configJson), `"qrValidForSeconds": 60,`, paperRules, 1))
+
+	v, err := NewVerifier(paperConfigJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	r5 := v.Verify(r2.Value)
+	if r5.Status != VERIFICATION_FAILED_ERROR || r5.Failure == nil || r5.Failure.Reason != FAILURE_REASON_DENYLISTED {
+		t.Fatal("Expected the paper proof to be denylisted")
+	}
+
+	// Another printout of the same credential has a different identifier, but has expired
+	r6 := DisclosePaperProof(r1.Value, credsJson[0])
+	if r6.Error != "" {
+		t.Fatal("Could not disclose paper proof:", r6.Error)
+	}
+
+	r7 := v.Verify(r6.Value)
+	if r7.Status != VERIFICATION_FAILED_ERROR || r7.Failure == nil || r7.Failure.Reason != FAILURE_REASON_CREDENTIAL_EXPIRED {
+		t.Fatal("Expected the paper proof to have expired")
+	}
+}
+
+func TestSelectiveDisclosure(t *testing.T) {
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", false)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	h, err := NewHolder([]byte(`{"domesticDisclosurePolicies": [{"id": "validity", "hiddenAttributes": ["birthDay", "birthMonth"]}]}`), pksConfig)
+	if err != nil {
+		t.Fatal("Could not create holder with disclosure policies", err)
+	}
+
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key:", r1.Error)
+	}
+
+	credsJson := issueTestCredentials(t, r1.Value, buildCredentialsAttributes(1))
+
+	r2 := h.DiscloseWithPolicy(r1.Value, credsJson[0], "validity")
+	if r2.Error != "" {
+		t.Fatal("Could not disclose with policy:", r2.Error)
+	}
+
+	r3 := Verify(r2.Value)
+	if r3.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify selective proof:", r3.Error)
+	}
+
+	if r3.DetailsV2.HiddenAttributes != "birthDay,birthMonth" || r3.DetailsV2.BirthDay != 0 || r3.Details.FirstNameInitial != "A" {
+		t.Fatal("Expected the birth data to be hidden, got", r3.DetailsV2.HiddenAttributes)
+	}
+
+	// Fully disclosed proofs don't report hidden attributes
+	r4 := h.Disclose(r1.Value, credsJson[0])
+	r5 := Verify(r4.Value)
+	if r5.Status != VERIFICATION_SUCCESS || r5.Details.HiddenAttributes != "" {
+		t.Fatal("Expected no hidden attributes for a fully disclosed proof")
+	}
+
+	r6 := h.DiscloseWithPolicy(r1.Value, credsJson[0], "unknown")
+	if r6.ErrorCode != ERROR_CODE_INVALID_CONFIG {
+		t.Fatal("Expected an invalid config error for an unknown disclosure policy, got", r6.ErrorCode)
+	}
+
+	// The validity attributes can't be hidden
+	holderSk, _ := unmarshalHolderSk(r1.Value)
+	cred, _ := unmarshalCredential(credsJson[0])
+	proof, err := discloseSelectivelyQREncoded(h.findIssuerPk, holderSk, cred, []string{"validFrom"}, time.Now())
+	if err != nil {
+		t.Fatal("Could not disclose selectively:", err)
+	}
+
+	r7 := Verify(proof)
+	if r7.Status != VERIFICATION_FAILED_ERROR || r7.Failure == nil || r7.Failure.Reason != FAILURE_REASON_INVALID_ATTRIBUTES {
+		t.Fatal("Expected an invalid attributes failure when hiding validFrom")
+	}
+
+	// A selective proof is not accepted as v2 proof
+	tamperedProof := []byte(strings.Replace(string(r2.Value), "NLS:", "NL2:", 1))
+	r8 := Verify(tamperedProof)
+	if r8.Status != VERIFICATION_FAILED_ERROR || r8.Failure == nil || r8.Failure.Reason != FAILURE_REASON_INVALID_PROOF {
+		t.Fatal("Expected an invalid proof failure for a selective proof as v2 proof")
+	}
+
+	verifiedCred, hiddenAttributes, err := verifySelectiveQREncoded(pksConfig.FindAndCacheDomestic, r2.Value)
+	if err != nil || len(hiddenAttributes) != 2 {
+		t.Fatal("Could not verify selective proof:", err)
+	}
+
+	// Revealing a hidden attribute, by moving it from the hidden to the disclosed attributes
+	revealedProof := tamperSelectiveProof(t, r2.Value, func(ps *selectiveProofSerialization) {
+		revealedIndex := ps.HiddenIndices[len(ps.HiddenIndices)-1]
+		ps.HiddenIndices = ps.HiddenIndices[:len(ps.HiddenIndices)-1]
+		ps.AResponses = ps.AResponses[:len(ps.AResponses)-1]
+
+		// The disclosed attributes are in order of their index, starting with the metadata at index 1
+		disclosureIndex := revealedIndex - 1 - len(ps.HiddenIndices)
+		revealedValue := new(gobig.Int).SetBytes([]byte("10"))
+		revealedValue.Lsh(revealedValue, 1).Add(revealedValue, gobig.NewInt(1))
+		ps.ADisclosed = append(ps.ADisclosed[:disclosureIndex], append([]*gobig.Int{revealedValue}, ps.ADisclosed[disclosureIndex:]...)...)
+	})
+
+	// Hiding other attributes than the ones that were hidden
+	rehiddenProof := tamperSelectiveProof(t, r2.Value, func(ps *selectiveProofSerialization) {
+		ps.HiddenIndices = []int{ps.HiddenIndices[0] - 2, ps.HiddenIndices[1] - 2}
+	})
+
+	for i, tamperedProof := range [][]byte{revealedProof, rehiddenProof} {
+		_, _, err = verifySelectiveQREncoded(pksConfig.FindAndCacheDomestic, tamperedProof)
+		if err == nil {
+			t.Fatal("Expected a tampered set of hidden attributes to be refused", i)
+		}
+	}
+
+	// A proof is refused against the public key of another issuer. Some test keys are the
+	// same key under another identifier, which are skipped.
+	issuerPk, err := pksConfig.FindAndCacheDomestic(verifiedCred.IssuerPkId)
+	if err != nil {
+		t.Fatal("Could not find issuer public key:", err)
+	}
+
+	for kid := range pksConfig.DomesticPks {
+		otherPk, err := pksConfig.FindAndCacheDomestic(kid)
+		if err != nil || otherPk.N.Cmp(issuerPk.N) == 0 {
+			continue
+		}
+
+		findOtherPk := func(string) (*gabi.PublicKey, error) {
+			return otherPk, nil
+		}
+
+		_, _, err = verifySelectiveQREncoded(findOtherPk, r2.Value)
+		if err == nil {
+			t.Fatal("Expected a selective proof to be refused against the public key", kid)
+		}
+	}
+}
+
+func tamperSelectiveProof(t *testing.T, proof []byte, tamper func(ps *selectiveProofSerialization)) []byte {
+	proofAsn1, err := base45.Base45Decode(proof[4:])
+	if err != nil {
+		t.Fatal("Could not base45 decode selective proof:", err)
+	}
+
+	ps := &selectiveProofSerialization{}
+	_, err = asn1.Unmarshal(proofAsn1, ps)
+	if err != nil {
+		t.Fatal("Could not unmarshal selective proof:", err)
+	}
+
+	tamper(ps)
+
+	proofAsn1, err = asn1.Marshal(*ps)
+	if err != nil {
+		t.Fatal("Could not marshal selective proof:", err)
+	}
+
+	proofBase45, err := base45.Base45Encode(proofAsn1)
+	if err != nil {
+		t.Fatal("Could not base45 encode selective proof:", err)
+	}
+
+	return append([]byte("NLS:"), proofBase45...)
+}
+
+func TestIssuanceSessions(t *testing.T) {
+	credentialAmount := 2
+
+	holderSkResult := GenerateHolderSk()
+	if holderSkResult.Error != "" {
+		t.Fatal("Could not generate holdercore secret key:", holderSkResult.Error)
+	}
+
+	ls, err := localsigner.NewFromString(testIssuerPkId, testIssuerPkXml, testIssuerSkXml, gabipool.NewRandomPool())
+	if err != nil {
+		t.Fatal("Could not create local signer:", err)
+	}
+
+	iss := issuer.New(ls)
+
+	// Start two issuances, that are both in flight at the same time
+	pims := make([]*idemixcommon.PrepareIssueMessage, 2)
+	sessionsJson := make([][]byte, 2)
+	icms := make([]*gabi.IssueCommitmentMessage, 2)
+	for i := 0; i < 2; i++ {
+		pims[i], err = iss.PrepareIssue(credentialAmount)
+		if err != nil {
+			t.Fatal("Could not prepare issue:", err)
+		}
+
+		pimJson, err := json.Marshal(pims[i])
+		if err != nil {
+			t.Fatal("Could not JSON marshal prepare issue message:", err)
+		}
+
+		r := CreateCommitmentMessageWithSession(holderSkResult.Value, pimJson)
+		if r.Error != "" {
+			t.Fatal("Could not create commitment message:", r.Error)
+		}
+
+		var resultValue *CreateCommitmentMessageResultValue
+		err = json.Unmarshal(r.Value, &resultValue)
+		if err != nil {
+			t.Fatal("Could not unmarshal create commitment message result:", err)
+		}
+
+		icms[i] = resultValue.IssueCommitmentMessage
+		sessionsJson[i], err = json.Marshal(resultValue.IssuanceSession)
+		if err != nil {
+			t.Fatal("Could not marshal issuance session:", err)
+		}
+	}
+
+	// Finish the issuances in reverse order
+	for i := 1; i >= 0; i-- {
+		ccms, err := iss.Issue(&issuer.IssueMessage{
+			PrepareIssueMessage:    pims[i],
+			IssueCommitmentMessage: icms[i],
+			CredentialsAttributes:  buildCredentialsAttributes(credentialAmount),
+		})
+		if err != nil {
+			t.Fatal("Could not issue create credential messages:", err)
+		}
+
+		ccmsJson, err := json.Marshal(ccms)
+		if err != nil {
+			t.Fatal("Could not marshal create credential messages:", err)
+		}
+
+		// Using the session of the other issuance should fail
+		r1 := CreateCredentialsWithSession(holderSkResult.Value, sessionsJson[1-i], ccmsJson)
+		if r1.Error == "" {
+			t.Fatal("Credentials should not be created with the issuance session of another issuance")
+		}
+
+		r2 := CreateCredentialsWithSession(holderSkResult.Value, sessionsJson[i], ccmsJson)
+		if r2.Error != "" {
+			t.Fatal("Could not create credentials:", r2.Error)
+		}
+
+		var createCredentialResults []*CreateCredentialResultValue
+		err = json.Unmarshal(r2.Value, &createCredentialResults)
+		if err != nil {
+			t.Fatal("Could not unmarshal create credential result values:", err)
+		}
+
+		if len(createCredentialResults) != credentialAmount {
+			t.Fatal("Invalid amount of create credential result values")
+		}
+	}
+}
+
+// The issuance proof builder mimics gabi.CredentialBuilder, so given the same randomness
+// both should produce exactly the same commitments, proofs and credentials
+func TestIssuanceProofBuilder(t *testing.T) {
+	pk, err := gabi.NewPublicKeyFromXML(testIssuerPkXml)
+	if err != nil {
+		t.Fatal("Could not load issuer public key:", err)
+	}
+
+	ls, err := localsigner.NewFromString(testIssuerPkId, testIssuerPkXml, testIssuerSkXml, gabipool.NewRandomPool())
+	if err != nil {
+		t.Fatal("Could not create local signer:", err)
+	}
+
+	iss := issuer.New(ls)
+	pim, err := iss.PrepareIssue(1)
+	if err != nil {
+		t.Fatal("Could not prepare issue:", err)
+	}
+
+	holderSk := idemixholder.GenerateSk()
+	holderNonce := idemixcommon.GenerateNonce()
+
+	// Let both builders draw the same random values
+	cryptoReader := rand.Reader
+	defer func() { rand.Reader = cryptoReader }()
+
+	rand.Reader = mathrand.New(mathrand.NewSource(1))
+	gabiBuilder := gabi.NewCredentialBuilder(pk, idemixcommon.BigOne, holderSk, holderNonce, nil)
+	gabiProofs := gabi.ProofBuilderList{gabiBuilder}.BuildProofList(idemixcommon.BigOne, pim.IssuerNonce, false)
+
+	rand.Reader = mathrand.New(mathrand.NewSource(1))
+	builder := newIssuanceProofBuilder(pk, holderSk)
+	proofs := gabi.ProofBuilderList{builder}.BuildProofList(idemixcommon.BigOne, pim.IssuerNonce, false)
+
+	rand.Reader = cryptoReader
+
+	gabiProofU, proofU := gabiProofs[0].(*gabi.ProofU), proofs[0].(*gabi.ProofU)
+	if gabiProofU.U.Cmp(proofU.U) != 0 || gabiProofU.C.Cmp(proofU.C) != 0 ||
+		gabiProofU.VPrimeResponse.Cmp(proofU.VPrimeResponse) != 0 || gabiProofU.SResponse.Cmp(proofU.SResponse) != 0 {
+		t.Fatal("The commitment proof differs from the one of gabi's credential builder")
+	}
+
+	// Construct the credential from the issued signature with both
+	ccms, err := iss.Issue(&issuer.IssueMessage{
+		PrepareIssueMessage: pim,
+		IssueCommitmentMessage: &gabi.IssueCommitmentMessage{
+			Proofs: proofs,
+			Nonce2: holderNonce,
+		},
+		CredentialsAttributes: buildCredentialsAttributes(1),
+	})
+	if err != nil {
+		t.Fatal("Could not issue create credential messages:", err)
+	}
+
+	attributeInts, err := idemixcommon.ComputeAttributeInts(ccms[0].Attributes)
+	if err != nil {
+		t.Fatal("Could not compute attributes:", err)
+	}
+
+	gabiCred, err := gabiBuilder.ConstructCredential(ccms[0].IssueSignatureMessage, attributeInts)
+	if err != nil {
+		t.Fatal("Could not construct credential with gabi's credential builder:", err)
+	}
+
+	cred, err := constructCredential(pk, holderSk, builder.vPrime, holderNonce, ccms[0])
+	if err != nil {
+		t.Fatal("Could not construct credential:", err)
+	}
+
+	if gabiCred.Signature.A.Cmp(cred.Signature.A) != 0 || gabiCred.Signature.E.Cmp(cred.Signature.E) != 0 ||
+		gabiCred.Signature.V.Cmp(cred.Signature.V) != 0 {
+		t.Fatal("The constructed credential differs from the one of gabi's credential builder")
+	}
+}
+
+func TestHolderErrorCodes(t *testing.T) {
+	holderSkResult := GenerateHolderSk()
+	if holderSkResult.Error != "" {
+		t.Fatal("Could not generate holdercore secret key:", holderSkResult.Error)
+	}
+
+	r1 := CreateCommitmentMessage([]byte(`"not a secret key"`), []byte(`{}`))
+	if r1.ErrorCode != ERROR_CODE_MALFORMED_INPUT {
+		t.Fatal("Expected malformed input error code for an invalid holder sk, got", r1.ErrorCode)
+	}
+
+	r2 := CreateCommitmentMessage(holderSkResult.Value, []byte(`{"issuerPkId": "unknownPk"}`))
+	if r2.ErrorCode != ERROR_CODE_UNKNOWN_PUBLIC_KEY {
+		t.Fatal("Expected unknown public key error code, got", r2.ErrorCode)
+	}
+
+	r3 := CreateCredentials([]byte(`[]`))
+	if r3.ErrorCode != ERROR_CODE_NO_PENDING_ISSUANCE {
+		t.Fatal("Expected no pending issuance error code, got", r3.ErrorCode)
+	}
+
+	r4 := CreateCredentialsWithSession(holderSkResult.Value, []byte(`null`), []byte(`[]`))
+	if r4.ErrorCode != ERROR_CODE_NO_PENDING_ISSUANCE {
+		t.Fatal("Expected no pending issuance error code for an absent session, got", r4.ErrorCode)
+	}
+
+	r5 := ReadDomesticCredential([]byte(`{`))
+	if r5.ErrorCode != ERROR_CODE_MALFORMED_INPUT {
+		t.Fatal("Expected malformed input error code for an invalid credential, got", r5.ErrorCode)
+	}
+
+	r6 := ReadEuropeanCredential([]byte(`HC1:invalid`))
+	if r6.ErrorCode != ERROR_CODE_MALFORMED_INPUT {
+		t.Fatal("Expected malformed input error code for an invalid European credential, got", r6.ErrorCode)
+	}
+
+	r7 := InitializeHolder("./nonexistent")
+	if r7.ErrorCode != ERROR_CODE_INVALID_CONFIG {
+		t.Fatal("Expected invalid config error code, got", r7.ErrorCode)
+	}
+}
+
+func TestUninitialized(t *testing.T) {
+	// Temporarily reset the default instances, as if the apps didn't initialize yet
+	initializedVerifier, initializedHolder := defaultVerifier, defaultHolder
+	defer func() { defaultVerifier, defaultHolder = initializedVerifier, initializedHolder }()
+
+	defaultVerifier, defaultHolder = &Verifier{}, nil
+
+	r1 := Disclose([]byte(`"1"`), []byte(`{}`))
+	if r1.ErrorCode != ERROR_CODE_NOT_INITIALIZED {
+		t.Fatal("Expected not initialized error code when disclosing, got", r1.ErrorCode)
+	}
+
+	r2 := ReadEuropeanCredential(defaultQR)
+	if r2.ErrorCode != ERROR_CODE_NOT_INITIALIZED {
+		t.Fatal("Expected not initialized error code when reading European credential, got", r2.ErrorCode)
+	}
+
+	r3 := Verify(deniedQr)
+	if r3.Status != VERIFICATION_FAILED_ERROR || r3.Failure == nil || r3.Failure.Reason != FAILURE_REASON_NOT_INITIALIZED {
+		t.Fatal("Expected not initialized failure reason when verifying")
+	}
+
+	r4 := CreateCommitmentMessage([]byte(`"1"`), []byte(`{}`))
+	if r4.ErrorCode != ERROR_CODE_NOT_INITIALIZED {
+		t.Fatal("Expected not initialized error code when creating commitments, got", r4.ErrorCode)
+	}
+
+	_, _, err := GetVerifiersForCLI()
+	if err == nil {
+		t.Fatal("Expected an error when getting the verifiers before initialization")
+	}
+
+	// Nil instances and inputs should result in errors as well
+	var v *Verifier
+	r5 := v.Verify(deniedQr)
+	if r5.Failure == nil || r5.Failure.Reason != FAILURE_REASON_NOT_INITIALIZED {
+		t.Fatal("Expected not initialized failure reason when verifying with a nil verifier")
+	}
+
+	err = v.Reload([]byte(`{}`), &PublicKeysConfig{})
+	if err == nil {
+		t.Fatal("Expected an error when reloading a nil verifier")
+	}
+
+	_, err = NewHolder([]byte(`{}`), nil)
+	if err == nil {
+		t.Fatal("Expected an error when creating a holder without public keys config")
+	}
+
+	// A verifier with an incomplete snapshot panics internally, which should result in an error
+	v = &Verifier{snapshot: &verifierSnapshot{}}
+
+	r6 := v.Verify(deniedQr)
+	if r6.Status != VERIFICATION_FAILED_ERROR || r6.Failure == nil || r6.Failure.Reason != FAILURE_REASON_INTERNAL_ERROR {
+		t.Fatal("Expected internal error failure reason after a recovered panic")
+	}
+}
+
 func TestUnrecognizedCred(t *testing.T) {
 	someQR := []byte(`1K9P/3FD!C.%2H5N4$**$IVY+3$`)
 
@@ -154,13 +701,14 @@ func TestUnrecognizedCred(t *testing.T) {
 }
 
 func TestDeniedProof(t *testing.T) {
-	deniedQr := []byte(`NL2:3QYLJN7UNC EJZ2I/1AJ/NLOSBX8O/N7*SQ376YP86E:U6ZO:5K UXRBMCARHV4ETZT1 -3-%CKD6T4MLMGS%:-S+U8EMJV0+3JINFCK4RYSQR8G/-JC M-L-VXS14XXNF-.-E 1:7H1X2GINPH0%YRP+/B.GSP4RHEDXRYTKO/VL1BC39X6MDM6ES+HPKH9VUS$XMYKU.%PJCCQT74HRY8$Q73I2P-77D$8NN.TK9PX4+/:8KR39HC*ZG86QJ9QKKJ.MAFYCPPV3BI*IYARY**J%WQAXX/-5KARDLZ9LXXIL%KKYF.X.JVM0$W0P4ATK66EQUI/R/7Z2TOHE4H:163J:7D5S X*ULK1VVYRC-4.PTE$ZJOWCGJR$UQAACJ1QAIXJ/SA1M1W NJBQQP56YY2V7YEP8E6:UD5AXMAXV*.DG.MW QQ/3QPEHR-YQIA0:85T+W4YC087A$MQ825173D/LBA0GL:88/S4Q8GNP2KCAD0LW$R1UXUH0PVCO4--1:+JH $PG6ZPORBHG7O4HU63-.1JZ9DUDACOHYZ869Y*X7TG+PYRRCY08*Q9DCAT0T:+HJ9B0ZS.NJIEHFTVEO8Y+L6$*H :TTSGRAS M9U8SLC+33/C3*86HAOW6PIPP13 HF+38%8EA$+7O+6+URI09%LDJX872V8 VM8O:Z1H0FIUVKGBBP4OL$Z0E8$KJAIUC6%8Y2BHX+95P.JP8CM1SUYF *J3UB3.KW81PJ$-8288C17NTCYFMI0%KB1GO07ZKB$R:DYFO+Q9:GA+9EE40Q3GQ53I-*:+*2U  LS 9O9Y2V7TZTO.FB5NSNMCOZX65WU%CYEJH$%9585A126-T5XB3%UVX3ULIQ5XJ7H.C%QG4RG$P L:C6WC*6N5X646 SJATTH85P5QJE/K3PU80CVYN+VZ9+8C8IPT+%T1YF50+4.NJPI12KM0..1ZDK/$NEZBVW-2TM+%V9$N00YUQSO 57M1JE-M2TT%%9RXHDWH/BFX3ZV/V6.S5F6BPJGZPJ4V$*K6ACOS6P:XFS-T-RW21H52 65VUSS*P505ILMZN%9DNRO42NKQKACHG/1GNLS V0OUUJL*9PZ/06SS9/GCFKIFW39KJ/ IVB10WE%T1C9MS2J4BR/9E$F5O5 DYPNVV9Y I0H4MRC5AO36UNWBRMCUPGCYZH+FIELM-R4:7L3L/L3F5WL4.-73494V.X67$*H$S9X51EX:6VRUMEBT224 +FW/0*4.V75:W:HXLB*Z6DGK27L.ZY-S4LZOP.HIWG:/PM9L6PVN.$PZDS$6$0KAL8OT/TM`)
 	r1 := Verify(deniedQr)
 	if r1.Status != VERIFICATION_FAILED_ERROR {
 		t.Fatal("QR could should have status error")
 	}
 }
 
+var deniedQr = []byte(`NL2:3QYLJN7UNC EJZ2I/1AJ/NLOSBX8O/N7*SQ376YP86E:U6ZO:5K UXRBMCARHV4ETZT1 -3-%CKD6T4MLMGS%:-S+U8EMJV0+3JINFCK4RYSQR8G/-JC M-L-VXS14XXNF-.-E 1:7H1X2GINPH0%YRP+/B.GSP4RHEDXRYTKO/VL1BC39X6MDM6ES+HPKH9VUS$XMYKU.%PJCCQT74HRY8$Q73I2P-77D$8NN.TK9PX4+/:8KR39HC*ZG86QJ9QKKJ.MAFYCPPV3BI*IYARY**J%WQAXX/-5KARDLZ9LXXIL%KKYF.X.JVM0$W0P4ATK66EQUI/R/7Z2TOHE4H:163J:7D5S X*ULK1VVYRC-4.PTE$ZJOWCGJR$UQAACJ1QAIXJ/SA1M1W NJBQQP56YY2V7YEP8E6:UD5AXMAXV*.DG.MW QQ/3QPEHR-YQIA0:85T+W4YC087A$MQ825173D/LBA0GL:88/S4Q8GNP2KCAD0LW$R1UXUH0PVCO4--1:+JH $PG6ZPORBHG7O4HU63-.1JZ9DUDACOHYZ869Y*X7TG+PYRRCY08*Q9DCAT0T:+HJ9B0ZS.NJIEHFTVEO8Y+L6$*H :TTSGRAS M9U8SLC+33/C3*86HAOW6PIPP13 HF+38%8EA$+7O+6+URI09%LDJX872V8 VM8O:Z1H0FIUVKGBBP4OL$Z0E8$KJAIUC6%8Y2BHX+95P.JP8CM1SUYF *J3UB3.KW81PJ$-8288C17NTCYFMI0%KB1GO07ZKB$R:DYFO+Q9:GA+9EE40Q3GQ53I-*:+*2U  LS 9O9Y2V7TZTO.FB5NSNMCOZX65WU%CYEJH$%9585A126-T5XB3%UVX3ULIQ5XJ7H.C%QG4RG$P L:C6WC*6N5X646 SJATTH85P5QJE/K3PU80CVYN+VZ9+8C8IPT+%T1YF50+4.NJPI12KM0..1ZDK/$NEZBVW-2TM+%V9$N00YUQSO 57M1JE-M2TT%%9RXHDWH/BFX3ZV/V6.S5F6BPJGZPJ4V$*K6ACOS6P:XFS-T-RW21H52 65VUSS*P505ILMZN%9DNRO42NKQKACHG/1GNLS V0OUUJL*9PZ/06SS9/GCFKIFW39KJ/ IVB10WE%T1C9MS2J4BR/9E$F5O5 DYPNVV9Y I0H4MRC5AO36UNWBRMCUPGCYZH+FIELM-R4:7L3L/L3F5WL4.-73494V.X67$*H$S9X51EX:6VRUMEBT224 +FW/0*4.V75:W:HXLB*Z6DGK27L.ZY-S4LZOP.HIWG:/PM9L6PVN.$PZDS$6$0KAL8OT/TM`)
+
 func buildCredentialsAttributes(credentialAmount int) []map[string]string {
 	cas := make([]map[string]string, 0, credentialAmount)
 
@@ -184,6 +732,74 @@ func buildCredentialsAttributes(credentialAmount int) []map[string]string {
 	return cas
 }
 
+// issueTestCredentials issues credentials with the given attributes to the holder secret key,
+// and returns them as credential JSON
+func issueTestCredentials(t *testing.T, holderSk []byte, credentialsAttributes []map[string]string) [][]byte {
+	ls, err := localsigner.NewFromString(testIssuerPkId, testIssuerPkXml, testIssuerSkXml, gabipool.NewRandomPool())
+	if err != nil {
+		t.Fatal("Could not create local signer:", err)
+	}
+
+	iss := issuer.New(ls)
+	pim, err := iss.PrepareIssue(len(credentialsAttributes))
+	if err != nil {
+		t.Fatal("Could not prepare issue:", err)
+	}
+
+	pimJson, err := json.Marshal(pim)
+	if err != nil {
+		t.Fatal("Could not JSON marshal prepare issue message:", err)
+	}
+
+	r1 := CreateCommitmentMessage(holderSk, pimJson)
+	if r1.Error != "" {
+		t.Fatal("Could not create commitment message:", r1.Error)
+	}
+
+	icm := new(gabi.IssueCommitmentMessage)
+	err = json.Unmarshal(r1.Value, icm)
+	if err != nil {
+		t.Fatal("Could not unmarshal issue commitment message:", err)
+	}
+
+	ccms, err := iss.Issue(&issuer.IssueMessage{
+		PrepareIssueMessage:    pim,
+		IssueCommitmentMessage: icm,
+		CredentialsAttributes:  credentialsAttributes,
+	})
+	if err != nil {
+		t.Fatal("Could not issue create credential messages:", err)
+	}
+
+	ccmsJson, err := json.Marshal(ccms)
+	if err != nil {
+		t.Fatal("Could not marshal create credential messages:", err)
+	}
+
+	r2 := CreateCredentials(ccmsJson)
+	if r2.Error != "" {
+		t.Fatal("Could not create credentials:", r2.Error)
+	}
+
+	var resultValues []*CreateCredentialResultValue
+	err = json.Unmarshal(r2.Value, &resultValues)
+	if err != nil {
+		t.Fatal("Could not unmarshal create credential result values:", err)
+	}
+
+	credsJson := make([][]byte, 0, len(resultValues))
+	for _, resultValue := range resultValues {
+		credJson, err := json.Marshal(resultValue.Credential)
+		if err != nil {
+			t.Fatal("Could not marshal credential:", err)
+		}
+
+		credsJson = append(credsJson, credJson)
+	}
+
+	return credsJson
+}
+
 func attributesToVerificationDetails(attributes map[string]string) VerificationDetails {
 	return VerificationDetails{
 		CredentialVersion: "2",
@@ -194,6 +810,8 @@ func attributesToVerificationDetails(attributes map[string]string) VerificationD
 		LastNameInitial:  attributes["lastNameInitial"],
 		BirthDay:         attributes["birthDay"],
 		BirthMonth:       attributes["birthMonth"],
+
+		VerificationPolicy: DEFAULT_VERIFICATION_POLICY,
 	}
 }
 
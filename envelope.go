@@ -0,0 +1,200 @@
+package mobilecore
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/go-errors/errors"
+	"go.mozilla.org/pkcs7"
+	"os"
+)
+
+// signedEnvelope is the format in which the backend serves the config and public keys:
+// the base64 encoded payload, together with a detached CMS (PKCS#7) signature over it
+type signedEnvelope struct {
+	Payload   []byte `json:"payload"`
+	Signature []byte `json:"signature"`
+}
+
+// pinnedSigningCertificates are the certificates that may sign an envelope. Besides being
+// used as trust roots for the signature chain, the signer itself must be one of them, so that
+// pinning a CA certificate doesn't accept envelopes signed by any other certificate of that CA.
+type pinnedSigningCertificates struct {
+	roots *x509.CertPool
+	certs []*x509.Certificate
+}
+
+// parseSigningCertificates parses the pinned (PEM encoded) signing certificates
+func parseSigningCertificates(signingCertsPem []byte) (*pinnedSigningCertificates, error) {
+	pinned := &pinnedSigningCertificates{
+		roots: x509.NewCertPool(),
+	}
+
+	rest := signingCertsPem
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			continue
+		}
+
+		pinned.roots.AddCert(cert)
+		pinned.certs = append(pinned.certs, cert)
+	}
+
+	if len(pinned.certs) == 0 {
+		return nil, codedErrorf(ERROR_CODE_INVALID_SIGNATURE, "Could not parse any PEM encoded signing certificate")
+	}
+
+	return pinned, nil
+}
+
+func (pinned *pinnedSigningCertificates) contains(cert *x509.Certificate) bool {
+	for _, pinnedCert := range pinned.certs {
+		if pinnedCert.Equal(cert) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readConfigFiles reads the config and public keys files. When signing certificates are given,
+// both files are expected to be signed envelopes, of which only the verified payload is returned.
+func readConfigFiles(configPath, pksPath string, signingCertsPem []byte) (configJson, pksJson []byte, err error) {
+	if signingCertsPem == nil {
+		configJson, err = os.ReadFile(configPath)
+		if err != nil {
+			return nil, nil, errors.WrapPrefix(err, "Could not read config file", 0)
+		}
+
+		pksJson, err = os.ReadFile(pksPath)
+		if err != nil {
+			return nil, nil, errors.WrapPrefix(err, "Could not read public keys file", 0)
+		}
+
+		return configJson, pksJson, nil
+	}
+
+	signingCerts, err := parseSigningCertificates(signingCertsPem)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	configJson, err = readSignedEnvelopeFile(configPath, signingCerts)
+	if err != nil {
+		return nil, nil, errors.WrapPrefix(err, "Could not open signed config", 0)
+	}
+
+	pksJson, err = readSignedEnvelopeFile(pksPath, signingCerts)
+	if err != nil {
+		return nil, nil, errors.WrapPrefix(err, "Could not open signed public keys", 0)
+	}
+
+	return configJson, pksJson, nil
+}
+
+// readValueSetsFile reads the optional value sets file, which is a signed envelope as well when
+// signing certificates are given. When the file is not present, no value sets are returned.
+func readValueSetsFile(valueSetsPath string, signingCertsPem []byte) (ValueSetsLookup, error) {
+	valueSetsJson, err := readOptionalFile(valueSetsPath, "value sets", signingCertsPem)
+	if err != nil || valueSetsJson == nil {
+		return nil, err
+	}
+
+	return NewValueSetsFromJson(valueSetsJson)
+}
+
+// readRevocationListsFile is the revocation lists counterpart of readValueSetsFile
+func readRevocationListsFile(revocationListsPath string, signingCertsPem []byte) (*RevocationLists, error) {
+	revocationListsJson, err := readOptionalFile(revocationListsPath, "revocation lists", signingCertsPem)
+	if err != nil || revocationListsJson == nil {
+		return nil, err
+	}
+
+	return NewRevocationListsFromJson(revocationListsJson)
+}
+
+// readOptionalFile reads a file that may be absent, in which case nil is returned without error
+func readOptionalFile(filePath, description string, signingCertsPem []byte) ([]byte, error) {
+	_, err := os.Stat(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if signingCertsPem == nil {
+		fileJson, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not read "+description+" file", 0)
+		}
+
+		return fileJson, nil
+	}
+
+	signingCerts, err := parseSigningCertificates(signingCertsPem)
+	if err != nil {
+		return nil, err
+	}
+
+	fileJson, err := readSignedEnvelopeFile(filePath, signingCerts)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not open signed "+description, 0)
+	}
+
+	return fileJson, nil
+}
+
+// readSignedEnvelopeFile reads a file containing a signed envelope, and returns the
+// payload only if the signature could be verified
+func readSignedEnvelopeFile(envelopePath string, signingCerts *pinnedSigningCertificates) ([]byte, error) {
+	envelopeJson, err := os.ReadFile(envelopePath)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read signed envelope file", 0)
+	}
+
+	return openSignedEnvelope(envelopeJson, signingCerts)
+}
+
+func openSignedEnvelope(envelopeJson []byte, signingCerts *pinnedSigningCertificates) ([]byte, error) {
+	var envelope *signedEnvelope
+	err := json.Unmarshal(envelopeJson, &envelope)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal signed envelope", 0)
+	}
+
+	if envelope == nil || len(envelope.Payload) == 0 || len(envelope.Signature) == 0 {
+		return nil, errors.Errorf("The signed envelope is missing its payload or signature")
+	}
+
+	p7, err := pkcs7.Parse(envelope.Signature)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not parse CMS signature", 0)
+	}
+
+	// The signature is detached, so the payload is the signed content
+	p7.Content = envelope.Payload
+
+	err = p7.VerifyWithChain(signingCerts.roots)
+	if err != nil {
+		return nil, errors.WrapPrefix(
+			codedErrorf(ERROR_CODE_INVALID_SIGNATURE, "%s", err.Error()),
+			"Could not verify CMS signature", 0,
+		)
+	}
+
+	signer := p7.GetOnlySigner()
+	if signer == nil || !signingCerts.contains(signer) {
+		return nil, codedErrorf(ERROR_CODE_INVALID_SIGNATURE, "The CMS signature was not made by a pinned signing certificate")
+	}
+
+	return envelope.Payload, nil
+}
@@ -0,0 +1,197 @@
+package mobilecore
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"go.mozilla.org/pkcs7"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSignedConfig(t *testing.T) {
+	cert, key := generateSigningCertificate(t, "Test config signer")
+	otherCert, otherKey := generateSigningCertificate(t, "Unpinned config signer")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config:", err)
+	}
+
+	pksJson, err := os.ReadFile("./testdata/public_keys.json")
+	if err != nil {
+		t.Fatal("Could not read public keys:", err)
+	}
+
+	// Correctly signed envelopes
+	dir := t.TempDir()
+	writeSignedEnvelope(t, path.Join(dir, VERIFIER_CONFIG_FILENAME), configJson, cert, key, false)
+	writeSignedEnvelope(t, path.Join(dir, VERIFIER_PUBLIC_KEYS_FILENAME), pksJson, cert, key, false)
+
+	r1 := InitializeVerifierWithSignedConfig(dir, certPem, time.Now().Unix())
+	if r1.Error != "" {
+		t.Fatal("Could not initialize verifier with signed config:", r1.Error)
+	}
+
+	r2 := InitializeHolderWithSignedConfig(dir, certPem)
+	if r2.Error != "" {
+		t.Fatal("Could not initialize holder with signed config:", r2.Error)
+	}
+
+	// The unwrapped files are not accepted when a signature is expected
+	r3 := InitializeVerifierWithSignedConfig("./testdata", certPem, time.Now().Unix())
+	if r3.Error == "" {
+		t.Fatal("Unsigned config was accepted")
+	}
+
+	// Tampered payload
+	tamperedDir := t.TempDir()
+	writeSignedEnvelope(t, path.Join(tamperedDir, VERIFIER_CONFIG_FILENAME), configJson, cert, key, true)
+	writeSignedEnvelope(t, path.Join(tamperedDir, VERIFIER_PUBLIC_KEYS_FILENAME), pksJson, cert, key, false)
+
+	r4 := InitializeVerifierWithSignedConfig(tamperedDir, certPem, time.Now().Unix())
+	if r4.ErrorCode != ERROR_CODE_INVALID_SIGNATURE {
+		t.Fatal("Tampered config didn't result in an invalid signature error:", r4.ErrorCode, r4.Error)
+	}
+
+	// Signed by a certificate that isn't pinned
+	unpinnedDir := t.TempDir()
+	writeSignedEnvelope(t, path.Join(unpinnedDir, VERIFIER_CONFIG_FILENAME), configJson, otherCert, otherKey, false)
+	writeSignedEnvelope(t, path.Join(unpinnedDir, VERIFIER_PUBLIC_KEYS_FILENAME), pksJson, otherCert, otherKey, false)
+
+	r5 := InitializeVerifierWithSignedConfig(unpinnedDir, certPem, time.Now().Unix())
+	if r5.ErrorCode != ERROR_CODE_INVALID_SIGNATURE {
+		t.Fatal("Config signed by an unpinned certificate didn't result in an invalid signature error:", r5.ErrorCode, r5.Error)
+	}
+
+	r6 := InitializeHolderWithSignedConfig(unpinnedDir, certPem)
+	if r6.ErrorCode != ERROR_CODE_INVALID_SIGNATURE {
+		t.Fatal("Holder config signed by an unpinned certificate didn't result in an invalid signature error:", r6.ErrorCode, r6.Error)
+	}
+
+	// Signed by a certificate that was issued by the pinned certificate, but isn't pinned itself
+	issuedCert, issuedKey := generateIssuedCertificate(t, "Issued config signer", cert, key)
+	issuedDir := t.TempDir()
+	writeSignedEnvelope(t, path.Join(issuedDir, VERIFIER_CONFIG_FILENAME), configJson, issuedCert, issuedKey, false)
+	writeSignedEnvelope(t, path.Join(issuedDir, VERIFIER_PUBLIC_KEYS_FILENAME), pksJson, issuedCert, issuedKey, false)
+
+	r9 := InitializeVerifierWithSignedConfig(issuedDir, certPem, time.Now().Unix())
+	if r9.ErrorCode != ERROR_CODE_INVALID_SIGNATURE {
+		t.Fatal("Config signed by a certificate issued by a pinned certificate didn't result in an invalid signature error:", r9.ErrorCode, r9.Error)
+	}
+
+	// Empty or unparseable PEM input
+	for _, signingCertsPem := range [][]byte{nil, {}, []byte("not a certificate")} {
+		r7 := InitializeVerifierWithSignedConfig(dir, signingCertsPem, time.Now().Unix())
+		if r7.ErrorCode != ERROR_CODE_INVALID_SIGNATURE {
+			t.Fatal("Invalid signing certificates didn't result in an invalid signature error:", r7.ErrorCode, r7.Error)
+		}
+
+		r8 := InitializeHolderWithSignedConfig(dir, signingCertsPem)
+		if r8.ErrorCode != ERROR_CODE_INVALID_SIGNATURE {
+			t.Fatal("Invalid holder signing certificates didn't result in an invalid signature error:", r8.ErrorCode, r8.Error)
+		}
+	}
+
+	// Restore the default instances for the other tests
+	TestInitialization(t)
+}
+
+func generateSigningCertificate(t *testing.T, commonName string) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Could not generate signing key:", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("Could not create signing certificate:", err)
+	}
+
+	cert, err := x509.ParseCertificate(certDer)
+	if err != nil {
+		t.Fatal("Could not parse signing certificate:", err)
+	}
+
+	return cert, key
+}
+
+func generateIssuedCertificate(t *testing.T, commonName string, issuerCert *x509.Certificate, issuerKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("Could not generate signing key:", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, template, issuerCert, &key.PublicKey, issuerKey)
+	if err != nil {
+		t.Fatal("Could not create signing certificate:", err)
+	}
+
+	cert, err := x509.ParseCertificate(certDer)
+	if err != nil {
+		t.Fatal("Could not parse signing certificate:", err)
+	}
+
+	return cert, key
+}
+
+func writeSignedEnvelope(t *testing.T, envelopePath string, payload []byte, cert *x509.Certificate, key *rsa.PrivateKey, tamper bool) {
+	signedData, err := pkcs7.NewSignedData(payload)
+	if err != nil {
+		t.Fatal("Could not create signed data:", err)
+	}
+
+	err = signedData.AddSigner(cert, key, pkcs7.SignerInfoConfig{})
+	if err != nil {
+		t.Fatal("Could not add signer:", err)
+	}
+
+	signedData.Detach()
+	signature, err := signedData.Finish()
+	if err != nil {
+		t.Fatal("Could not finish signature:", err)
+	}
+
+	envelopePayload := append([]byte{}, payload...)
+	if tamper {
+		envelopePayload[len(envelopePayload)/2] ^= 0x01
+	}
+
+	envelopeJson, err := json.Marshal(&signedEnvelope{
+		Payload:   envelopePayload,
+		Signature: signature,
+	})
+	if err != nil {
+		t.Fatal("Could not JSON marshal envelope:", err)
+	}
+
+	err = os.WriteFile(envelopePath, envelopeJson, 0600)
+	if err != nil {
+		t.Fatal("Could not write envelope:", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
 	"github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -43,7 +44,7 @@ func TestDCCs(t *testing.T) {
 	validRecTime := "2021-08-15"
 	validTestTime := "2021-07-23T08:00:00Z"
 
-	rules := verifierConfig.EuropeanVerificationRules
+	rules := defaultVerifier.getSnapshot().config.EuropeanVerificationRules
 
 	testCases := []dccTestCase{
 		// Different amount of statements
@@ -199,9 +200,235 @@ func TestDCCs(t *testing.T) {
 	}
 }
 
+func TestDCCFailureReasons(t *testing.T) {
+	rules := defaultVerifier.getSnapshot().config.EuropeanVerificationRules
+
+	testCases := []struct {
+		statements string
+		changes    []structChange
+		now        string
+		reason     string
+		validFrom  string
+		validUntil string
+	}{
+		{"", nil, "2021-07-01", FAILURE_REASON_INVALID_STATEMENT_AMOUNT, "", ""},
+		{"V", dobChange("90-01-01"), "2021-07-01", FAILURE_REASON_INVALID_DATE_OF_BIRTH, "", ""},
+		{"V", vaccChange("Sputnik-V", "MedicinalProduct"), "2021-07-01", FAILURE_REASON_VACCINE_NOT_ALLOWED, "", ""},
+		{"V", vaccDoseChange(1, 2), "2021-07-01", FAILURE_REASON_VACCINATION_INCOMPLETE, "", ""},
+		{"V", nil, "2021-06-21", FAILURE_REASON_VACCINATION_NOT_YET_VALID, "2021-06-22T00:00:00Z", ""},
+		{"R", nil, "2021-09-13", FAILURE_REASON_RECOVERY_EXPIRED, "2021-07-12T00:00:00Z", "2021-09-12T00:00:00Z"},
+		{"T", nil, "2021-07-24T00:00:00Z", FAILURE_REASON_TEST_EXPIRED, "2021-07-22T20:22:00Z", "2021-07-23T21:22:00Z"},
+		{"T", testChange("260373001", "TestResult"), "2021-07-23T08:00:00Z", FAILURE_REASON_TEST_POSITIVE, "", ""},
+		{"T", testChange("840539007", "DiseaseTargeted"), "2021-07-23T08:00:00Z", FAILURE_REASON_DISEASE_NOT_COVID_19, "", ""},
+	}
+
+	parseTimestamp := func(value string) int64 {
+		if value == "" {
+			return 0
+		}
+
+		res, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal("Could not parse time", value)
+		}
+
+		return res.Unix()
+	}
+
+	for i, testCase := range testCases {
+		now, err := time.Parse(time.RFC3339, testCase.now)
+		if err != nil {
+			now, err = time.Parse("2006-01-02", testCase.now)
+			if err != nil {
+				t.Fatal("Could not parse date")
+			}
+		}
+
+		hcert := getHcert(testCase.statements, testCase.changes)
+		err = validateDCC(hcert.DCC, rules, now)
+		if err == nil {
+			t.Fatal("Expected an error for test case", i)
+		}
+
+		failure := getVerificationFailure(err)
+		if failure.Reason != testCase.reason {
+			t.Fatal("Expected reason", testCase.reason, "for test case", i, "but got", failure.Reason)
+		}
+
+		if failure.ValidFrom != parseTimestamp(testCase.validFrom) || failure.ValidUntil != parseTimestamp(testCase.validUntil) {
+			t.Fatal("Unexpected validity window for test case", i)
+		}
+	}
+}
+
+func TestRATDeviceAllowlist(t *testing.T) {
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	devicesJson := `"testAllowedRATDevices": [
+		{"id": "1232"},
+		{"id": "1304", "validFrom": "2021-07-01", "validUntil": "2021-07-22"}
+	],
+	"testValidityHours": 25,`
+	config, err := parseVerifierConfig([]byte(strings.Replace(string(configJson), `"testValidityHours": 25,`, devicesJson, 1)))
+	if err != nil {
+		t.Fatal("Could not parse config with RAT devices", err)
+	}
+
+	rules := config.EuropeanVerificationRules
+	now, _ := time.Parse(time.RFC3339, "2021-07-23T08:00:00Z")
+
+	// The test of the testcases is collected at 2021-07-22T20:22:00Z
+	ratChange := testChange("LP217198-3", "TypeOfTest")
+	testCases := []struct {
+		changes []structChange
+		isValid bool
+	}{
+		{nil, true},
+		{ratChange, false},
+		{append(testChange("1232", "TestNameAndManufacturer"), ratChange...), true},
+		{append(testChange(" 1232 ", "TestNameAndManufacturer"), ratChange...), true},
+		{append(testChange("1304", "TestNameAndManufacturer"), ratChange...), true},
+		{append(testChange("1333", "TestNameAndManufacturer"), ratChange...), false},
+		{append(append(testChange("1304", "TestNameAndManufacturer"), ratChange...), testChange("2021-07-23T00:00:00Z", "DateTimeOfCollection")...), false},
+		{append(append(testChange("1304", "TestNameAndManufacturer"), ratChange...), testChange("2021-06-30T23:00:00Z", "DateTimeOfCollection")...), false},
+	}
+
+	for i, testCase := range testCases {
+		err = validateTest(getHcert("T", testCase.changes).DCC.Tests[0], rules, now)
+		isValid := err == nil
+		if isValid != testCase.isValid {
+			t.Fatal("Expected validity", testCase.isValid, "for test case", i, err)
+		}
+
+		if !isValid && getVerificationFailure(err).Reason != FAILURE_REASON_TEST_DEVICE_NOT_ALLOWED {
+			t.Fatal("Expected a device failure for test case", i, err)
+		}
+	}
+
+	// Invalid device entries are reported
+	invalidDevicesJson := `"testAllowedRATDevices": [
+		{"id": ""},
+		{"id": "1232"},
+		{"id": "1232", "validFrom": "2021-07-22", "validUntil": "2021-07-01"},
+		{"id": "1304", "validFrom": "yesterday"}
+	],
+	"testValidityHours": 25,`
+	invalidConfig := mustUnmarshalVerifierConfig(t, []byte(strings.Replace(string(configJson), `"testValidityHours": 25,`, invalidDevicesJson, 1)))
+
+	issues := validateVerifierConfig(invalidConfig)
+	if len(issues) != 4 {
+		t.Fatal("Expected 4 device issues, got", len(issues))
+	}
+}
+
+func TestVaccinationProductRules(t *testing.T) {
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	// Replace the deprecated Janssen fields by product rules
+	productRulesJson := `"vaccinationValidityDays": 270,
+	"vaccinationProductRules": [
+		{"medicinalProduct": "EU/1/20/1525", "validityDelayDays": 28, "primarySeriesDoses": 1},
+		{"medicinalProduct": "EU/1/20/1528", "validityDelayDays": 7, "validityDays": 180, "primarySeriesDoses": 2, "boosterValidityDelayDays": 1}
+	],`
+	productRulesConfigJson := strings.Replace(string(configJson), `"vaccinationJanssenValidityDelayDays": 28,`, productRulesJson, 1)
+	productRulesConfigJson = strings.Replace(productRulesConfigJson, `"vaccinationJanssenValidityDelayIntoForceDate": "2021-08-14",`, "", 1)
+
+	config, err := parseVerifierConfig([]byte(productRulesConfigJson))
+	if err != nil {
+		t.Fatal("Could not parse config with product rules", err)
+	}
+
+	rules := config.EuropeanVerificationRules
+
+	// The base vaccination is EU/1/20/1507 2/2 at 2021-06-08
+	comirnaty := vaccChange("EU/1/20/1528", "MedicinalProduct")
+	testCases := []struct {
+		changes    []structChange
+		now        string
+		reason     string
+		validFrom  string
+		validUntil string
+	}{
+		// Generic rules, with the generic maximum validity
+		{nil, "2021-06-22", "", "2021-06-22", "2022-03-05"},
+		{nil, "2021-06-21", FAILURE_REASON_VACCINATION_NOT_YET_VALID, "2021-06-22", "2022-03-05"},
+		{nil, "2022-03-06", FAILURE_REASON_VACCINATION_EXPIRED, "2021-06-22", "2022-03-05"},
+
+		// Product specific delay and maximum validity
+		{comirnaty, "2021-06-14", FAILURE_REASON_VACCINATION_NOT_YET_VALID, "2021-06-15", "2021-12-05"},
+		{comirnaty, "2021-12-05", "", "2021-06-15", "2021-12-05"},
+		{comirnaty, "2021-12-06", FAILURE_REASON_VACCINATION_EXPIRED, "2021-06-15", "2021-12-05"},
+
+		// Boosters by dose number, with the booster delay of the product
+		{append(comirnaty, vaccDoseChange(3, 3)...), "2021-06-08", FAILURE_REASON_VACCINATION_NOT_YET_VALID, "2021-06-09", ""},
+		{append(comirnaty, vaccDoseChange(3, 3)...), "2023-01-01", "", "2021-06-09", ""},
+		{append(vaccJanssen("2021-06-08"), vaccDoseChange(2, 1)...), "2021-06-08", "", "2021-06-08", ""},
+		{append(vaccJanssen("2021-06-08"), vaccDoseChange(2, 2)...), "2021-06-08", "", "2021-06-08", ""},
+		{vaccDoseChange(3, 2), "2021-06-08", "", "2021-06-08", ""},
+
+		// A regular Janssen vaccination has the longer product delay
+		{append(vaccJanssen("2021-06-08"), vaccDoseChange(1, 1)...), "2021-07-05", FAILURE_REASON_VACCINATION_NOT_YET_VALID, "2021-07-06", "2022-03-05"},
+		{append(vaccJanssen("2021-06-08"), vaccDoseChange(1, 1)...), "2021-07-06", "", "2021-07-06", "2022-03-05"},
+	}
+
+	for i, testCase := range testCases {
+		now, _ := time.Parse(YYYYMMDD_FORMAT, testCase.now)
+		vacc := getHcert("V", testCase.changes).DCC.Vaccinations[0]
+
+		validFrom, validUntil, err := vaccinationValidity(vacc, rules)
+		if err != nil {
+			t.Fatal("Could not compute validity of test case", i, err)
+		}
+
+		if validFrom.Format(YYYYMMDD_FORMAT) != testCase.validFrom {
+			t.Fatal("Expected valid from", testCase.validFrom, "for test case", i, "but got", validFrom)
+		}
+
+		if (validUntil.IsZero() && testCase.validUntil != "") || (!validUntil.IsZero() && validUntil.Format(YYYYMMDD_FORMAT) != testCase.validUntil) {
+			t.Fatal("Expected valid until", testCase.validUntil, "for test case", i, "but got", validUntil)
+		}
+
+		err = validateVaccination(vacc, rules, now)
+		if testCase.reason == "" {
+			if err != nil {
+				t.Fatal("Expected test case", i, "to be valid", err)
+			}
+		} else if err == nil || getVerificationFailure(err).Reason != testCase.reason {
+			t.Fatal("Expected reason", testCase.reason, "for test case", i, err)
+		}
+	}
+
+	// The deprecated Janssen fields are translated into a product rule
+	legacyRules := defaultVerifier.getSnapshot().config.EuropeanVerificationRules
+	janssenRule := legacyRules.findVaccinationProductRule(VACCINE_MEDICINAL_PRODUCT_JANSSEN)
+	if janssenRule == nil || *janssenRule.ValidityDelayDays != 28 || janssenRule.ValidityDelayIntoForceDateStr != "2021-08-14" {
+		t.Fatal("Expected the Janssen fields to be translated into a product rule")
+	}
+
+	// Invalid product rules are reported
+	invalidProductRulesJson := `"vaccinationValidityDays": -1,
+	"vaccinationProductRules": [
+		{"medicinalProduct": ""},
+		{"medicinalProduct": "EU/1/20/1528", "validityDelayDays": -1},
+		{"medicinalProduct": "EU/1/20/1528", "validityDelayIntoForceDate": "tomorrow"}
+	],`
+	invalidConfig := mustUnmarshalVerifierConfig(t, []byte(strings.Replace(string(configJson), `"vaccinationJanssenValidityDelayDays": 28,`, invalidProductRulesJson, 1)))
+
+	issues := validateVerifierConfig(invalidConfig)
+	if len(issues) != 5 {
+		t.Fatal("Expected 5 vaccination issues, got", len(issues))
+	}
+}
+
 func TestHcertResult(t *testing.T) {
 	baseResult := VerificationDetails{
-		"1", "0", "NL", "A", "B", "13", "03",
+		"1", "0", "NL", "A", "B", "13", "03", "", "",
 	}
 
 	// Rest of the test cases
@@ -1,6 +1,12 @@
 package mobilecore
 
 import (
+	"github.com/fxamacker/cbor/v2"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	hcertverifier "github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -15,12 +21,12 @@ func TestExampleQRs(t *testing.T) {
 			t.Fatal("Expected readability", testcase.expectedReadability, "of testcase", i, r1.Error)
 		}
 
-		r2 := InitializeVerifier("./testdata")
+		r2 := InitializeVerifier("./testdata", time.Now().Unix())
 		if r2.Error != "" {
 			t.Fatal("Could not initialize verifier", r2.Error)
 		}
 
-		r3 := verify(testcase.qr, now)
+		r3 := defaultVerifier.verify(testcase.qr, now)
 		didError := r3.Error != ""
 		expectError := testcase.expectedStatus == VERIFICATION_FAILED_ERROR
 		if didError != expectError {
@@ -42,6 +48,104 @@ func TestExampleQRs(t *testing.T) {
 	}
 }
 
+func TestMultipleVerifiers(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	_, err = NewVerifier(configJson, nil, time.Now())
+	if err == nil {
+		t.Fatal("Verifier should not be created without public keys config")
+	}
+
+	// Create a second configuration without the European denylist entry
+	otherConfigJson := []byte(strings.Replace(string(configJson), "7EXmXBhfyBZJgt1dki0cfQ==", "", 1))
+
+	v1, err := NewVerifier(configJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	v2, err := NewVerifier(otherConfigJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create other verifier", err)
+	}
+
+	r1 := v1.verify(denylistedQR, now)
+	if r1.Status != VERIFICATION_FAILED_ERROR {
+		t.Fatal("Denylisted QR should not verify with the first verifier")
+	}
+
+	// The denylisted QR is an NL DCC, so without the denylist entry it is recognized as such
+	r2 := v2.verify(denylistedQR, now)
+	if r2.Status != VERIFICATION_FAILED_IS_NL_DCC {
+		t.Fatal("Denylisted QR should not be denied by the other verifier", r2.Error)
+	}
+}
+
+func TestConcurrentVerificationAndReload(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	v, err := NewVerifier(configJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	// Verify European and (denied) domestic QRs from multiple goroutines, while reloading the config
+	var wg sync.WaitGroup
+	errs := make(chan string, 100)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 10; j++ {
+				r1 := v.verify(defaultQR, now)
+				if r1.Status != VERIFICATION_SUCCESS {
+					errs <- "Could not verify European QR: " + r1.Error
+				}
+
+				r2 := v.verify(deniedQr, now)
+				if r2.Status != VERIFICATION_FAILED_ERROR {
+					errs <- "Denied domestic QR should not verify"
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		err = v.Reload(configJson, pksConfig)
+		if err != nil {
+			t.Fatal("Could not reload verifier", err)
+		}
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for msg := range errs {
+		t.Fatal(msg)
+	}
+}
+
 func TestParseBirthDay(t *testing.T) {
 	cases := [][]string{
 		{"1980-01-12", "valid", "1980", "01", "12"},
@@ -81,6 +185,215 @@ func TestParseBirthDay(t *testing.T) {
 	}
 }
 
+func TestFailureReasons(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	r1 := InitializeVerifier("./testdata", time.Now().Unix())
+	if r1.Error != "" {
+		t.Fatal("Could not initialize verifier", r1.Error)
+	}
+
+	r2 := defaultVerifier.verify(denylistedQR, now)
+	if r2.Failure == nil || r2.Failure.Reason != FAILURE_REASON_DENYLISTED {
+		t.Fatal("Expected the denylisted failure reason")
+	}
+
+	r3 := defaultVerifier.verify(defaultQR[:50], now)
+	if r3.Failure == nil || r3.Failure.Reason != FAILURE_REASON_INVALID_PROOF {
+		t.Fatal("Expected the invalid proof failure reason")
+	}
+
+	// Verify with a verifier that doesn't know any European keys
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	v, err := NewVerifier(configJson, &PublicKeysConfig{
+		DomesticPks: DomesticPksLookup{},
+		EuropeanPks: hcertverifier.PksLookup{},
+	}, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	r4 := v.verify(defaultQR, now)
+	if r4.Failure == nil || r4.Failure.Reason != FAILURE_REASON_UNKNOWN_KEY {
+		t.Fatal("Expected the unknown key failure reason for a European QR")
+	}
+
+	r5 := v.verify(deniedQr, now)
+	if r5.Failure == nil || r5.Failure.Reason != FAILURE_REASON_UNKNOWN_KEY {
+		t.Fatal("Expected the unknown key failure reason for a domestic QR")
+	}
+
+	// Successful verifications don't have a failure
+	r6 := defaultVerifier.verify(defaultQR, now)
+	if r6.Failure != nil {
+		t.Fatal("Expected no failure for a valid QR")
+	}
+}
+
+func TestUnprotectedKIDFailureReasons(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	cwt, err := hcertcommon.UnmarshalQREncoded(defaultQR)
+	if err != nil {
+		t.Fatal("Could not unmarshal QR", err)
+	}
+
+	knownKID, err := readEuropeanKID(defaultQR)
+	if err != nil {
+		t.Fatal("Could not read KID", err)
+	}
+
+	// Move the KID to the unprotected header, which invalidates the signature
+	var protectedHeader *hcertcommon.CWTHeader
+	err = cbor.Unmarshal(cwt.Protected, &protectedHeader)
+	if err != nil {
+		t.Fatal("Could not unmarshal protected header", err)
+	}
+
+	cwt.Protected, err = cbor.Marshal(&hcertcommon.CWTHeader{Alg: protectedHeader.Alg})
+	if err != nil {
+		t.Fatal("Could not marshal protected header", err)
+	}
+
+	for _, kid := range [][]byte{knownKID, []byte("unknown")} {
+		cwt.Unprotected.KID = kid
+		qr, err := hcertcommon.MarshalQREncoded(cwt)
+		if err != nil {
+			t.Fatal("Could not marshal QR", err)
+		}
+
+		readKID, err := readEuropeanKID(qr)
+		if err != nil || string(readKID) != string(kid) {
+			t.Fatal("Could not read KID from the unprotected header", err)
+		}
+
+		expectedReason := FAILURE_REASON_INVALID_PROOF
+		if string(kid) != string(knownKID) {
+			expectedReason = FAILURE_REASON_UNKNOWN_KEY
+		}
+
+		r := defaultVerifier.verify(qr, now)
+		if r.Failure == nil || r.Failure.Reason != expectedReason {
+			t.Fatal("Expected the", expectedReason, "failure reason for an unprotected KID")
+		}
+	}
+}
+
+func TestCountryRules(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	// The vaccination of the default QR is from 2021-07-10, so it is not yet valid in BE,
+	// and its medicinal product isn't accepted in DE
+	countryRulesJson := `"europeanCountryRules": {
+		"BE": {
+			"rulesVersion": "BE-2021-07",
+			"testAllowedTypes": ["LP6464-4"],
+			"testValidityHours": 72,
+			"vaccinationValidityDelayDays": 30,
+			"vaccineAllowedProducts": ["EU/1/20/1528"],
+			"recoveryValidFromDays": 11,
+			"recoveryValidUntilDays": 180
+		},
+		"DE": {
+			"rulesVersion": "DE-2021-07",
+			"testAllowedTypes": ["LP6464-4"],
+			"testValidityHours": 48,
+			"vaccinationValidityDelayDays": 14,
+			"vaccineAllowedProducts": ["EU/1/20/1507"],
+			"recoveryValidFromDays": 28,
+			"recoveryValidUntilDays": 180
+		}
+	},
+	"configTTL": 86400,`
+	countryConfigJson := strings.Replace(string(configJson), `"configTTL": 86400,`, countryRulesJson, 1)
+	countryConfigJson = strings.Replace(countryConfigJson, `"testValidityHours": 25,`, `"rulesVersion": "NL-2021-07", "testValidityHours": 25,`, 1)
+
+	v, err := NewVerifier([]byte(countryConfigJson), pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	testCases := []struct {
+		qr                 []byte
+		countryOfArrival   string
+		countryOfDeparture string
+		expectedStatus     int
+		expectedReason     string
+		expectedVersion    string
+	}{
+		{defaultQR, "", "", VERIFICATION_SUCCESS, "", "NL-2021-07"},
+		{defaultQR, "NL", "", VERIFICATION_SUCCESS, "", "NL-2021-07"},
+		{defaultQR, " be", "", VERIFICATION_FAILED_ERROR, FAILURE_REASON_VACCINATION_NOT_YET_VALID, "BE-2021-07"},
+		{defaultQR, "DE", "", VERIFICATION_FAILED_ERROR, FAILURE_REASON_VACCINE_NOT_ALLOWED, "DE-2021-07"},
+		{defaultQR, "NL", "BE", VERIFICATION_FAILED_ERROR, FAILURE_REASON_VACCINATION_NOT_YET_VALID, "NL-2021-07"},
+		{defaultQR, "NL", "NL", VERIFICATION_SUCCESS, "", "NL-2021-07"},
+		{defaultQR, "FR", "", VERIFICATION_FAILED_ERROR, FAILURE_REASON_UNKNOWN_COUNTRY, ""},
+		{defaultQR, "NL", "FR", VERIFICATION_FAILED_ERROR, FAILURE_REASON_UNKNOWN_COUNTRY, ""},
+		{nlQR, "NL", "", VERIFICATION_FAILED_IS_NL_DCC, "", ""},
+		{[]byte("NL2:ABC"), "BE", "", VERIFICATION_FAILED_ERROR, FAILURE_REASON_NOT_VALID_IN_COUNTRY, ""},
+	}
+
+	for i, testCase := range testCases {
+		options := &verificationOptions{
+			countryOfArrival:   testCase.countryOfArrival,
+			countryOfDeparture: testCase.countryOfDeparture,
+		}
+
+		r := v.verifyWithOptions(testCase.qr, options, now)
+		if r.Status != testCase.expectedStatus {
+			t.Fatal("Expected status", testCase.expectedStatus, "for test case", i, "but got", r.Status, r.Error)
+		}
+
+		if testCase.expectedReason != "" && r.Failure.Reason != testCase.expectedReason {
+			t.Fatal("Expected failure reason", testCase.expectedReason, "for test case", i, "but got", r.Failure.Reason)
+		}
+
+		if r.RulesVersion != testCase.expectedVersion {
+			t.Fatal("Expected rules version", testCase.expectedVersion, "for test case", i, "but got", r.RulesVersion)
+		}
+	}
+
+	// An NL DCC is verified against the rules of other countries of arrival
+	r := v.verifyWithOptions(nlQR, &verificationOptions{countryOfArrival: "BE"}, now)
+	if r.Status == VERIFICATION_FAILED_IS_NL_DCC {
+		t.Fatal("Expected an NL DCC to be verified for another country of arrival")
+	}
+
+	// The denylist of the Netherlands applies to other countries of arrival as well
+	r = v.verifyWithOptions(denylistedQR, &verificationOptions{countryOfArrival: "BE"}, now)
+	if r.Failure == nil || r.Failure.Reason != FAILURE_REASON_DENYLISTED {
+		t.Fatal("Expected a proof on the denylist of the Netherlands to be denied for another country of arrival")
+	}
+
+	// Country rules are keyed by an uppercase country code other than NL
+	invalidConfigJsons := []string{
+		strings.Replace(countryConfigJson, `"BE": {`, `"be": {`, 1),
+		strings.Replace(countryConfigJson, `"BE": {`, `"NL": {`, 1),
+		strings.Replace(countryConfigJson, `"testValidityHours": 72,`, `"testValidityHours": 0,`, 1),
+	}
+
+	for i, invalidConfigJson := range invalidConfigJsons {
+		_, err = NewVerifier([]byte(invalidConfigJson), pksConfig, time.Now())
+		if err == nil || !strings.Contains(err.Error(), "europeanCountryRules.") {
+			t.Fatal("Expected an issue with the country rules for invalid config", i, err)
+		}
+	}
+}
+
 type qrTestcase struct {
 	qr                  []byte
 	expectedStatus      int
@@ -95,7 +408,7 @@ var cuwSubjectAltNameQR = []byte(`HC1:NCF120F90T9WTWGVLK679LDU%KDP:M$-FX*4FBB4W0
 var missingSubjectAltNameQR = []byte(`HC1:NCF120F90T9WTWGVLK589F7I%KDP:M$-FX*4FBB4W0*70J+9DN03E53F35%64:HY50.FK8ZKO/EZKEZ967L6C56GVC*JC1A6C%63W5Y96.96TPCBEC7ZKW.CZ-C/ C/PDXKEW.C8WEHS8FN9GY8 JC0/DAC81/DMPCG/DFUCL+9VY87:EDOL9WEQDD+Q6TW6FA7C466KCK9E2H9G:6V6BEM6Q$D.UDRYA 96NF6L/5SW6VX6B$D% D3IA4W5646646-96:96XJC +D3KC-SCXJCCWENF6OF63W59%6.96WJCT3EJ+9%JC+QENQ4ZED+EDKWE3EFX3ET34X C:VDG7D82BUVDGECDZCCECRTCUOA04E4WEOPCN8FHZA1+92ZAQB9746VG7TS9F690N8*CBAY9LH8V09GTAQ7BL1BSG8.Q6WK427BCGW*/1RSNGLRRGB4C1G3DLDQX:FB5L%.CJTSET2ZF6-KUGVTHW40D4%HUCUHCJETO7RC7QQ2J2LT$1$6DG32INGI 3XVMZA7V50U507BWO1K80`)
 var denylistedQR = []byte(`HC1:NCF%RN%TS3DH0RGPJB/IB-OM7533SR99H9M9*VIHWFA K:SCWH3HXK6UO2Y9SA3/-2E%5G%5TW5A 6+O6XL69/9-3AKI67ZMLEQZ76QW6.V99Q9E$BDZIC9J-XIJZIC0J$PIR$SBZI92K-+T38K:ZJ83BV.T8DUFAB4DNAHLW 70SO:GOLIROGOAQ53+LDYPWGO+9A4EOHCR:36UA73NPZ.4IWM%J81:6G16IFNPCL694F$9DK4LC6DQ4394HW6.Y5K45$84-/5$B4D64OBL395$W15ORL355*K7 O%PQX76LZ6B69X5QG5AFY1OSM3-E5ZM3765WU2IMMQUKPHP-E4/H8$1YCV$QECTUKK60VEQA6E+6UCE.UUMYJ3EVFDU9VU1$D.K9H5CKMQ53K$SC4EHXDE5SBCU7RVKG9LJJDX1V4-T2DD5*J/ZCAUHZDR6UT%1WJBN0-8URPSSNIJE7UH5%5000U50/EW%E2U0`)
 
-var defaultDetails = &VerificationDetails{"1", "1", "XX", "A", "D", "15", "01"}
+var defaultDetails = &VerificationDetails{"1", "1", "XX", "A", "D", "15", "01", "", DEFAULT_VERIFICATION_POLICY}
 
 var wholeNumberFloatDoseQR = []byte(`HC1:NCF%RN%TS3DH0RGPJB/IB-OM7533SR769CIN3XHW2KWP5IJBOJAFYHPI1SA3/-2E%5G%5TW5A 6+O6XL69/9-3AKI6/Q6LEQZ76UW6S$99Q9E$BDZIJ7JGOIRHSK2C%0KJZIC0JYPI2SSK S.-3O4UBZI92K3TSH7JPOJZ0KRPI/JTPCTHABVCNAHLW 70SO:GOLIROGO3T59YLLYP-HQLTQV*OOGOBR7Z6NC8P$WA3AA9EPBDSM+QFE4:/6N9R%EPXCROGO3HOWGOKEQ395WDUK:V9Z0O598+94DM.J9WVHWVH+ZE5%PUU1NTIUZUG-VVLIWQHSUAOP6OH6XO9IE5IVU5P2-GA*PE+E6MPO+SEMF2/GA H2.GA JG TUAJ9WLIFO5HI8J.V/I8*Z7ON1Z:LBYFEKG*ZNLT7P 7:%BU*R/L0..P5:PGSG7 9RWIXJ40H1-BW42R$D8*ZSDTOVETQTB+:RHALY3WKAJVINC/RS$B.FC+.TAWPHWC5:1/77I*5+7N UMJRF/ORN 9AKF:ONZQNT4L72V6H6$%9224U50-BWLTUB5`)
 var fractionalFloatDoseQR = []byte(`HC1:NCF%RN%TS3DH0RGPJB/IB-OM7533SR769FLT3XHW2KWP5IJBOJAFYHPI1SA3/-2E%5G%5TW5A 6+O6XL69/9-3AKI6/Q6LEQZ76UW6S$99Q9E$BDZIJ7JGOIRHSK2C%0KJZIC0JYPI2SSK S.-3O4UBZI92K3TSH7JPOJZ0KRPI/JTPCTHABVCNAHLW 70SO:GOLIROGO3T59YLY1S7HOPC5NDOEC5L64HX6IAS3DS2980IQ.DPL95OD6%28%%BPHQOGO+GOT*OBR7 Z4VBNL+1U46UF5/NVVAW+PPWC5PF6846A$QY76UW6VY9U3Q5WUZE98T5LAAY0Q$UPR$5:NLOEPNRAE69K PBKPC21%.PTM9*H9699LN9O11$DPPF5PK9CZL*H1VUUME1L8VNF6H*MF U8LELE1*.1-9VW11B%EHE14+1E*U6W1-Q6/LAPMHO99Y0VL+A*JKMJ58QKSAQQEHR8KS+D5DOGWF4EC6*MKSLFG5:SRWX1T554EWCNSQ%KD-T487*7H9DDF:KO:LKNVK/DHPUC+D1H0A:M88G000FGWSXB2 F`)
@@ -3,10 +3,13 @@ module github.com/minvws/nl-covid19-coronacheck-mobile-core
 go 1.16
 
 require (
+	github.com/fxamacker/cbor/v2 v2.2.0
 	github.com/go-errors/errors v1.4.0
+	github.com/minvws/base45-go v0.1.0
 	github.com/minvws/nl-covid19-coronacheck-hcert v0.4.1
 	github.com/minvws/nl-covid19-coronacheck-idemix v0.5.2
 	github.com/privacybydesign/gabi v0.0.0-20200823153621-467696543652
+	go.mozilla.org/pkcs7 v0.0.0-20200128120323-432b2356ecb1
 )
 
 replace (
@@ -2,10 +2,10 @@ package mobilecore
 
 import (
 	"encoding/json"
+	"github.com/go-errors/errors"
 	hcertholder "github.com/minvws/nl-covid19-coronacheck-hcert/holder"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
 	idemixholder "github.com/minvws/nl-covid19-coronacheck-idemix/holder"
-	"github.com/privacybydesign/gabi"
-	"os"
 	"path"
 )
 
@@ -14,45 +14,115 @@ const (
 	HOLDER_PUBLIC_KEYS_FILENAME = "public_keys.json"
 )
 
-var (
-	holderConfig *holderConfiguration
+// Holder holds a holder configuration together with the public keys of the issuers,
+// so that multiple independent holder setups can be used within a single process
+type Holder struct {
+	config *holderConfiguration
 
+	findIssuerPk   idemixcommon.FindIssuerPkFunc
 	domesticHolder *idemixholder.Holder
 	europeanHolder *hcertholder.Holder
 
-	lastCredBuilders []gabi.ProofBuilder
-)
+	// The optional EU value sets, to display the codes of a DCC
+	valueSets ValueSetsLookup
+}
 
+// The default holder instance, as used by the mobile apps through InitializeHolder
+var defaultHolder *Holder
+
+// holderConfiguration carries the same rules as the verifier config, so that the holder can show
+// how the verifier will judge its credentials, together with the settings of the holder itself
 type holderConfiguration struct {
-	// Until business rules are part of the config, we don't need anything from here
+	DomesticVerificationRules *domesticVerificationRules `json:"domesticVerificationRules"`
+	EuropeanVerificationRules *europeanVerificationRules `json:"europeanVerificationRules"`
+
+	// Domestic credentials should be refreshed when they cover less than the threshold hours, and
+	// European credentials when they expire within the threshold days. Zero disables refreshing.
+	DomesticCredentialRefreshThresholdHours int `json:"domesticCredentialRefreshThresholdHours"`
+	EuropeanCredentialRefreshThresholdDays  int `json:"europeanCredentialRefreshThresholdDays"`
+
+	// The maximum number of credentials that are stored at once, of which zero means unlimited
+	MaxStoredCredentials int `json:"maxStoredCredentials"`
+
+	DomesticDisclosurePolicies []*disclosurePolicy `json:"domesticDisclosurePolicies"`
 }
 
 func InitializeHolder(configDirectoryPath string) *Result {
+	return initializeHolder(configDirectoryPath, nil)
+}
+
+// InitializeHolderWithSignedConfig is the holder counterpart of InitializeVerifierWithSignedConfig
+func InitializeHolderWithSignedConfig(configDirectoryPath string, signingCertsPem []byte) *Result {
+	if len(signingCertsPem) == 0 {
+		return ErrorResult(codedErrorf(ERROR_CODE_INVALID_SIGNATURE, "No signing certificates were provided"))
+	}
+
+	return initializeHolder(configDirectoryPath, signingCertsPem)
+}
+
+func initializeHolder(configDirectoryPath string, signingCertsPem []byte) (result *Result) {
+	defer recoverResult(&result)
+
 	configPath := path.Join(configDirectoryPath, HOLDER_CONFIG_FILENAME)
 	pksPath := path.Join(configDirectoryPath, HOLDER_PUBLIC_KEYS_FILENAME)
 
-	// Load config
-	configJson, err := os.ReadFile(configPath)
+	// Load config and public keys, verifying their signature if requested
+	configJson, pksJson, err := readConfigFiles(configPath, pksPath, signingCertsPem)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not read holder config file")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not read holder config files")
 	}
 
-	err = json.Unmarshal(configJson, &holderConfig)
+	// Read public keys
+	publicKeysConfig, err := NewPublicKeysConfigFromJson(pksJson, false)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not JSON unmarshal holder config")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not load public keys config")
 	}
 
-	// Read public keys
-	publicKeysConfig, err := NewPublicKeysConfig(pksPath, false)
+	// Read the value sets, if present
+	valueSets, err := readValueSetsFile(path.Join(configDirectoryPath, VALUE_SETS_FILENAME), signingCertsPem)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not load public keys config")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not load value sets")
 	}
 
-	// Initialize holders
-	domesticHolder = idemixholder.New(publicKeysConfig.FindAndCacheDomestic)
-	europeanHolder = hcertholder.New()
+	// Create the default holder
+	holder, err := NewHolder(configJson, publicKeysConfig)
+	if err != nil {
+		return ErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG))
+	}
+
+	holder.valueSets = valueSets
+
+	defaultHolder = holder
+
+	return &Result{nil, "", ""}
+}
+
+// NewHolder creates a holder from the JSON holder configuration and the public keys config
+func NewHolder(configJson []byte, publicKeysConfig *PublicKeysConfig) (*Holder, error) {
+	if publicKeysConfig == nil {
+		return nil, errors.Errorf("No public keys config was provided")
+	}
+
+	config, err := parseHolderConfig(configJson)
+	if err != nil {
+		return nil, err
+	}
+
+	return newHolderWithConfig(config, publicKeysConfig), nil
+}
+
+func newHolderWithConfig(config *holderConfiguration, publicKeysConfig *PublicKeysConfig) *Holder {
+	return &Holder{
+		config:         config,
+		findIssuerPk:   publicKeysConfig.FindAndCacheDomestic,
+		domesticHolder: idemixholder.New(publicKeysConfig.FindAndCacheDomestic),
+		europeanHolder: hcertholder.New(),
+	}
+}
 
-	return &Result{nil, ""}
+// As the holder methods are also used through the default holder, they guard against a nil holder
+func holderNotInitializedResult() *Result {
+	return ErrorResult(codedErrorf(ERROR_CODE_NOT_INITIALIZED, "The holder has not been initialized"))
 }
 
 // DEPRECATED: See deprecation of LoadDomesticIssuerPks
@@ -60,14 +130,14 @@ var HasLoadedDomesticIssuerPks bool = false
 
 // DEPRECATED: Remove this method when the mobile apps have migrated to using
 //  InitializeHolder and the holder package directly
-func LoadDomesticIssuerPks(annotatedPksJson []byte) *Result {
-	holderConfig = &holderConfiguration{}
+func LoadDomesticIssuerPks(annotatedPksJson []byte) (result *Result) {
+	defer recoverResult(&result)
 
 	// Unmarshal JSON list of keys
 	annotatedPks := make([]*AnnotatedDomesticPk, 0)
 	err := json.Unmarshal(annotatedPksJson, &annotatedPks)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not unmarshal annotated issuer public keys")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not unmarshal annotated issuer public keys")
 	}
 
 	// Transform legacy keys
@@ -76,12 +146,11 @@ func LoadDomesticIssuerPks(annotatedPksJson []byte) *Result {
 	}
 	publicKeysConfig.TransformLegacyDomesticPks()
 
-	// Initialize holders
-	domesticHolder = idemixholder.New(publicKeysConfig.FindAndCacheDomestic)
-	europeanHolder = hcertholder.New()
+	// Initialize the default holder
+	defaultHolder = newHolderWithConfig(&holderConfiguration{}, publicKeysConfig)
 
 	// Set loaded status
 	HasLoadedDomesticIssuerPks = true
 
-	return &Result{nil, ""}
+	return &Result{nil, "", ""}
 }
@@ -0,0 +1,106 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+)
+
+// GetHolderConfig returns the config of the default holder as JSON, as it was validated
+// by InitializeHolder
+func GetHolderConfig() *Result {
+	return defaultHolder.GetHolderConfig()
+}
+
+func (h *Holder) GetHolderConfig() (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	configJson, err := json.Marshal(h.config)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal holder config")
+	}
+
+	return &Result{configJson, "", ""}
+}
+
+// ValidateHolderConfig is the holder counterpart of ValidateVerifierConfig
+func ValidateHolderConfig(configJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	config, err := unmarshalHolderConfig(configJson)
+	if err != nil {
+		return ErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG))
+	}
+
+	issuesJson, err := json.Marshal(validateHolderConfig(config))
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal config issues")
+	}
+
+	return &Result{issuesJson, "", ""}
+}
+
+func parseHolderConfig(configJson []byte) (*holderConfiguration, error) {
+	config, err := unmarshalHolderConfig(configJson)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse the config if there is any issue with it
+	issues := validateHolderConfig(config)
+	if len(issues) != 0 {
+		return nil, configIssuesError(issues)
+	}
+
+	if config.EuropeanVerificationRules != nil {
+		prepareEuropeanVerificationRules(config.EuropeanVerificationRules)
+	}
+
+	return config, nil
+}
+
+func unmarshalHolderConfig(configJson []byte) (*holderConfiguration, error) {
+	var config *holderConfiguration
+	err := json.Unmarshal(configJson, &config)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal holder config", 0)
+	}
+
+	if config == nil {
+		return nil, errors.Errorf("The holder config was empty")
+	}
+
+	return config, nil
+}
+
+// validateHolderConfig validates the rules only when present, as older holder configs don't have them
+func validateHolderConfig(config *holderConfiguration) configIssues {
+	issues := configIssues{}
+
+	if config.DomesticVerificationRules != nil {
+		validateDomesticVerificationRules("domesticVerificationRules", config.DomesticVerificationRules, issues.add)
+	}
+
+	if config.EuropeanVerificationRules != nil {
+		validateEuropeanVerificationRules("europeanVerificationRules", config.EuropeanVerificationRules, issues.add)
+	}
+
+	if config.DomesticCredentialRefreshThresholdHours < 0 {
+		issues.add("domesticCredentialRefreshThresholdHours", "Should not be negative, but is %d", config.DomesticCredentialRefreshThresholdHours)
+	}
+
+	if config.EuropeanCredentialRefreshThresholdDays < 0 {
+		issues.add("europeanCredentialRefreshThresholdDays", "Should not be negative, but is %d", config.EuropeanCredentialRefreshThresholdDays)
+	}
+
+	if config.MaxStoredCredentials < 0 {
+		issues.add("maxStoredCredentials", "Should not be negative, but is %d", config.MaxStoredCredentials)
+	}
+
+	validateDisclosurePolicies(config.DomesticDisclosurePolicies, issues.add)
+
+	return issues
+}
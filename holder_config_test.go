@@ -0,0 +1,79 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestHolderConfig(t *testing.T) {
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", false)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	// The test config is shared with the verifier, and carries the same rules
+	r1 := InitializeHolder("./testdata")
+	if r1.Error != "" {
+		t.Fatal("Could not initialize holder", r1.Error)
+	}
+
+	r2 := GetHolderConfig()
+	if r2.Error != "" {
+		t.Fatal("Could not get holder config", r2.Error)
+	}
+
+	var config *holderConfiguration
+	err = json.Unmarshal(r2.Value, &config)
+	if err != nil {
+		t.Fatal("Could not unmarshal holder config", err)
+	}
+
+	if config.EuropeanVerificationRules.TestValidityHours != 25 || config.DomesticVerificationRules.QRValidForSeconds != 60 {
+		t.Fatal("Expected the rules in the holder config")
+	}
+
+	// The Janssen fields are translated into a product rule, as with the verifier config
+	if len(config.EuropeanVerificationRules.VaccinationProductRules) != 1 {
+		t.Fatal("Expected the translated Janssen product rule in the holder config")
+	}
+
+	r3 := GetEuropeanValidity(defaultQR, nil)
+	if r3.Error != "" {
+		t.Fatal("Could not get European validity with the rules of the holder config", r3.Error)
+	}
+
+	// Older holder configs without rules and settings remain valid
+	h, err := NewHolder([]byte(`{}`), pksConfig)
+	if err != nil {
+		t.Fatal("Could not create holder without rules", err)
+	}
+
+	r4 := h.GetEuropeanValidity(defaultQR, nil)
+	if r4.ErrorCode != ERROR_CODE_INVALID_CONFIG {
+		t.Fatal("Expected an invalid config error without rules, got", r4.ErrorCode)
+	}
+
+	invalidConfigJsons := []string{
+		`null`,
+		`{"maxStoredCredentials": -1}`,
+		`{"domesticCredentialRefreshThresholdHours": -24}`,
+		`{"europeanVerificationRules": {"testValidityHours": 25}}`,
+		`{"domesticVerificationRules": {"qrValidForSeconds": 0}}`,
+		`{"domesticDisclosurePolicies": [{"id": "validity", "hiddenAttributes": ["validFrom"]}]}`,
+		`{"domesticDisclosurePolicies": [{"hiddenAttributes": ["birthDay"]}]}`,
+	}
+
+	for i, invalidConfigJson := range invalidConfigJsons {
+		_, err = NewHolder([]byte(invalidConfigJson), pksConfig)
+		if err == nil {
+			t.Fatal("Expected an error for invalid holder config", i)
+		}
+	}
+
+	r5 := ValidateHolderConfig([]byte(`{"maxStoredCredentials": -1, "europeanCredentialRefreshThresholdDays": -1}`))
+	var issues []*ConfigIssue
+	err = json.Unmarshal(r5.Value, &issues)
+	if err != nil || len(issues) != 2 || issues[0].Field != "europeanCredentialRefreshThresholdDays" {
+		t.Fatal("Expected two issues with the holder config", string(r5.Value))
+	}
+}
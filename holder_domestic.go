@@ -8,6 +8,7 @@ import (
 	"github.com/privacybydesign/gabi"
 	"github.com/privacybydesign/gabi/big"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -16,29 +17,67 @@ type CreateCredentialResultValue struct {
 	Attributes map[string]string `json:"attributes"`
 }
 
-func GenerateHolderSk() *Result {
+// DiscloseBestResultValue contains the proof of the chosen credential, by its index in the given
+// list of credentials. The times are unix timestamps, of which the next valid from is zero when
+// none of the credentials becomes valid in the future.
+type DiscloseBestResultValue struct {
+	Proof           string `json:"proof"`
+	CredentialIndex int    `json:"credentialIndex"`
+	ValidFrom       int64  `json:"validFrom"`
+	ValidUntil      int64  `json:"validUntil"`
+	NextValidFrom   int64  `json:"nextValidFrom"`
+}
+
+func GenerateHolderSk() (result *Result) {
+	defer recoverResult(&result)
+
 	holderSkJson, err := json.Marshal(holder.GenerateSk())
 	if err != nil {
 		return WrappedErrorResult(err, "Could not serialize holdercore secret key")
 	}
 
-	return &Result{holderSkJson, ""}
+	return &Result{holderSkJson, "", ""}
+}
+
+type CreateCommitmentMessageResultValue struct {
+	IssueCommitmentMessage *gabi.IssueCommitmentMessage `json:"issueCommitmentMessage"`
+	IssuanceSession        *IssuanceSession             `json:"issuanceSession"`
+}
+
+// DEPRECATED: The pending issuance session of CreateCommitmentMessage, until the mobile apps have
+// migrated to CreateCommitmentMessageWithSession and CreateCredentialsWithSession
+var lastIssuance *pendingIssuance
+var lastIssuanceLock sync.Mutex
+
+type pendingIssuance struct {
+	holderSk *big.Int
+	session  *IssuanceSession
 }
 
-func CreateCommitmentMessage(holderSkJson, prepareIssueMessageJson []byte) *Result {
+// DEPRECATED: Use CreateCommitmentMessageWithSession, which doesn't keep the issuance state in memory
+func CreateCommitmentMessage(holderSkJson, prepareIssueMessageJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	lastIssuanceLock.Lock()
+	defer lastIssuanceLock.Unlock()
+
+	lastIssuance = nil
+
+	if defaultHolder == nil {
+		return holderNotInitializedResult()
+	}
+
 	holderSk, err := unmarshalHolderSk(holderSkJson)
 	if err != nil {
 		return ErrorResult(err)
 	}
 
-	pim := &idemixcommon.PrepareIssueMessage{}
-	err = json.Unmarshal(prepareIssueMessageJson, pim)
+	pim, err := unmarshalPrepareIssueMessage(prepareIssueMessageJson)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not JSON unmarshal prepare issue message")
+		return ErrorResult(err)
 	}
 
-	var icm *gabi.IssueCommitmentMessage
-	lastCredBuilders, icm, err = domesticHolder.CreateCommitments(holderSk, pim)
+	session, icm, err := defaultHolder.createCommitments(holderSk, pim)
 	if err != nil {
 		return WrappedErrorResult(err, "Could not create commitments")
 	}
@@ -48,26 +87,111 @@ func CreateCommitmentMessage(holderSkJson, prepareIssueMessageJson []byte) *Resu
 		return WrappedErrorResult(err, "Could not marshal issue commitment message")
 	}
 
-	return &Result{icmJson, ""}
+	lastIssuance = &pendingIssuance{holderSk, session}
+
+	return &Result{icmJson, "", ""}
+}
+
+// DEPRECATED: Use CreateCredentialsWithSession together with CreateCommitmentMessageWithSession
+func CreateCredentials(ccmsJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	lastIssuanceLock.Lock()
+	issuance := lastIssuance
+	lastIssuance = nil
+	lastIssuanceLock.Unlock()
+
+	if issuance == nil {
+		return ErrorResult(codedErrorf(ERROR_CODE_NO_PENDING_ISSUANCE, "CreateCommitmentMessage should be called before CreateCredentials"))
+	}
+
+	if defaultHolder == nil {
+		return holderNotInitializedResult()
+	}
+
+	return defaultHolder.createCredentialsResult(issuance.holderSk, issuance.session, ccmsJson)
+}
+
+func CreateCommitmentMessageWithSession(holderSkJson, prepareIssueMessageJson []byte) *Result {
+	return defaultHolder.CreateCommitmentMessage(holderSkJson, prepareIssueMessageJson)
+}
+
+func CreateCredentialsWithSession(holderSkJson, issuanceSessionJson, ccmsJson []byte) *Result {
+	return defaultHolder.CreateCredentials(holderSkJson, issuanceSessionJson, ccmsJson)
+}
+
+// CreateCommitmentMessage returns both the issue commitment message that is to be sent to the issuer,
+// and the issuance session that should be kept until CreateCredentials is called
+func (h *Holder) CreateCommitmentMessage(holderSkJson, prepareIssueMessageJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	pim, err := unmarshalPrepareIssueMessage(prepareIssueMessageJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	session, icm, err := h.createCommitments(holderSk, pim)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not create commitments")
+	}
+
+	resultValue := &CreateCommitmentMessageResultValue{
+		IssueCommitmentMessage: icm,
+		IssuanceSession:        session,
+	}
+
+	resultValueJson, err := json.Marshal(resultValue)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal issue commitment message")
+	}
+
+	return &Result{resultValueJson, "", ""}
 }
 
-func CreateCredentials(ccmsJson []byte) *Result {
-	credBuilders := lastCredBuilders
-	lastCredBuilders = nil
+func (h *Holder) CreateCredentials(holderSkJson, issuanceSessionJson, ccmsJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	var session *IssuanceSession
+	err = json.Unmarshal(issuanceSessionJson, &session)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not unmarshal issuance session")
+	}
 
-	if credBuilders == nil {
-		return ErrorResult(errors.Errorf("CreateCommitmentMessage should be called before CreateCredentials"))
+	if session == nil {
+		return ErrorResult(codedErrorf(ERROR_CODE_NO_PENDING_ISSUANCE, "No issuance session was provided"))
 	}
 
+	return h.createCredentialsResult(holderSk, session, ccmsJson)
+}
+
+func (h *Holder) createCredentialsResult(holderSk *big.Int, session *IssuanceSession, ccmsJson []byte) *Result {
 	var ccms []*idemixcommon.CreateCredentialMessage
 	err := json.Unmarshal(ccmsJson, &ccms)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not unmarshal create credential messages")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not unmarshal create credential messages")
 	}
 
-	creds, err := domesticHolder.CreateCredentials(credBuilders, ccms)
+	creds, err := h.createCredentials(holderSk, session, ccms)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not create credentials")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_ISSUANCE_FAILED), "Could not create credentials")
 	}
 
 	results := make([]*CreateCredentialResultValue, 0, len(creds))
@@ -90,10 +214,12 @@ func CreateCredentials(ccmsJson []byte) *Result {
 		return WrappedErrorResult(err, "Could not marshal read credential result")
 	}
 
-	return &Result{resultsJson, ""}
+	return &Result{resultsJson, "", ""}
 }
 
-func ReadDomesticCredential(credJson []byte) *Result {
+func ReadDomesticCredential(credJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
 	cred, err := unmarshalCredential(credJson)
 	if err != nil {
 		return ErrorResult(err)
@@ -109,14 +235,96 @@ func ReadDomesticCredential(credJson []byte) *Result {
 		return WrappedErrorResult(err, "Could marshal attributes")
 	}
 
-	return &Result{attributesJson, ""}
+	return &Result{attributesJson, "", ""}
 }
 
 func Disclose(holderSkJson, credJson []byte) *Result {
-	return disclose(holderSkJson, credJson, time.Now())
+	return defaultHolder.Disclose(holderSkJson, credJson)
+}
+
+func (h *Holder) Disclose(holderSkJson, credJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	return h.disclose(holderSkJson, credJson, time.Now())
+}
+
+func (h *Holder) disclose(holderSkJson, credJson []byte, now time.Time) *Result {
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	cred, err := unmarshalCredential(credJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	proofPrefixed, err := h.domesticHolder.DiscloseAllWithTimeQREncoded(holderSk, cred, now)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not disclosure credential")
+	}
+
+	return &Result{proofPrefixed, "", ""}
+}
+
+// DiscloseWithPolicy discloses a credential like Disclose, but hides the attributes of the given
+// disclosure policy of the holder config. Verifiers report which attributes were hidden.
+func DiscloseWithPolicy(holderSkJson, credJson []byte, disclosurePolicyId string) *Result {
+	return defaultHolder.DiscloseWithPolicy(holderSkJson, credJson, disclosurePolicyId)
+}
+
+func (h *Holder) DiscloseWithPolicy(holderSkJson, credJson []byte, disclosurePolicyId string) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	return h.discloseWithPolicy(holderSkJson, credJson, disclosurePolicyId, time.Now())
+}
+
+func (h *Holder) discloseWithPolicy(holderSkJson, credJson []byte, disclosurePolicyId string, now time.Time) *Result {
+	policy, err := h.config.findDisclosurePolicy(disclosurePolicyId)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	cred, err := unmarshalCredential(credJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	proofPrefixed, err := discloseSelectivelyQREncoded(h.findIssuerPk, holderSk, cred, policy.HiddenAttributes, now)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not disclosure credential")
+	}
+
+	return &Result{proofPrefixed, "", ""}
+}
+
+// DisclosePaperProof discloses a paper proof credential for printing. The disclosure time is set to
+// the valid from of the credential, so that the printed proof is static and doesn't reveal when it
+// was printed. Verifiers exempt paper proofs from the QR freshness check.
+func DisclosePaperProof(holderSkJson, credJson []byte) *Result {
+	return defaultHolder.DisclosePaperProof(holderSkJson, credJson)
 }
 
-func disclose(holderSkJson, credJson []byte, now time.Time) *Result {
+func (h *Holder) DisclosePaperProof(holderSkJson, credJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
 	holderSk, err := unmarshalHolderSk(holderSkJson)
 	if err != nil {
 		return ErrorResult(err)
@@ -127,29 +335,159 @@ func disclose(holderSkJson, credJson []byte, now time.Time) *Result {
 		return ErrorResult(err)
 	}
 
-	proofPrefixed, err := domesticHolder.DiscloseAllWithTimeQREncoded(holderSk, cred, now)
+	attributes, err := readCredentialWithVersion(cred)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	if attributes["isPaperProof"] != "1" {
+		return ErrorResult(codedErrorf(ERROR_CODE_MALFORMED_INPUT, "The credential is not a paper proof"))
+	}
+
+	validFrom, _, err := domesticValidity(attributes["validFrom"], attributes["validForHours"])
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not read credential validity")
+	}
+
+	proofPrefixed, err := h.domesticHolder.DiscloseAllWithTimeQREncoded(holderSk, cred, validFrom)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not disclosure credential")
+	}
+
+	return &Result{proofPrefixed, "", ""}
+}
+
+// DiscloseBest discloses the credential that is currently valid for the longest time, out of the
+// given JSON list of credentials, so that the app doesn't need to know about their validity
+func DiscloseBest(holderSkJson, credentialsJson []byte, nowUnix int64) *Result {
+	return defaultHolder.DiscloseBest(holderSkJson, credentialsJson, nowUnix)
+}
+
+func (h *Holder) DiscloseBest(holderSkJson, credentialsJson []byte, nowUnix int64) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	return h.discloseBest(holderSkJson, credentialsJson, time.Unix(nowUnix, 0))
+}
+
+func (h *Holder) discloseBest(holderSkJson, credentialsJson []byte, now time.Time) *Result {
+	holderSk, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	validities, err := readDomesticValidities(credentialsJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	// Choose the valid credential with the latest expiry, skipping expired and not yet valid ones
+	var best *gabi.Credential
+	resultValue := &DiscloseBestResultValue{CredentialIndex: -1}
+	for i, validity := range validities {
+		if now.Before(validity.validFrom) {
+			if resultValue.NextValidFrom == 0 || validity.validFrom.Unix() < resultValue.NextValidFrom {
+				resultValue.NextValidFrom = validity.validFrom.Unix()
+			}
+
+			continue
+		}
+
+		if !now.Before(validity.validUntil) || (best != nil && validity.validUntil.Unix() <= resultValue.ValidUntil) {
+			continue
+		}
+
+		best = validity.cred
+		resultValue.CredentialIndex = i
+		resultValue.ValidFrom = validity.validFrom.Unix()
+		resultValue.ValidUntil = validity.validUntil.Unix()
+	}
+
+	if best == nil {
+		return ErrorResult(codedErrorf(ERROR_CODE_CREDENTIAL_EXPIRED, "None of the %d credentials is currently valid", len(validities)))
+	}
+
+	proofPrefixed, err := h.domesticHolder.DiscloseAllWithTimeQREncoded(holderSk, best, now)
 	if err != nil {
 		return WrappedErrorResult(err, "Could not disclosure credential")
 	}
 
-	return &Result{proofPrefixed, ""}
+	resultValue.Proof = string(proofPrefixed)
+
+	resultValueJson, err := json.Marshal(resultValue)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal disclose best result")
+	}
+
+	return &Result{resultValueJson, "", ""}
+}
+
+// domesticCredentialValidity is the validity window of a single domestic credential
+type domesticCredentialValidity struct {
+	cred       *gabi.Credential
+	validFrom  time.Time
+	validUntil time.Time
+}
+
+// readDomesticValidities reads the validity windows of a JSON list of credentials, in their order
+func readDomesticValidities(credentialsJson []byte) ([]*domesticCredentialValidity, error) {
+	var credJsons []json.RawMessage
+	err := json.Unmarshal(credentialsJson, &credJsons)
+	if err != nil {
+		return nil, errors.WrapPrefix(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not unmarshal credentials", 0)
+	}
+
+	validities := make([]*domesticCredentialValidity, 0, len(credJsons))
+	for _, credJson := range credJsons {
+		cred, err := unmarshalCredential(credJson)
+		if err != nil {
+			return nil, err
+		}
+
+		attributes, err := readCredentialWithVersion(cred)
+		if err != nil {
+			return nil, err
+		}
+
+		validFrom, validUntil, err := domesticValidity(attributes["validFrom"], attributes["validForHours"])
+		if err != nil {
+			return nil, errors.WrapPrefix(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not read credential validity", 0)
+		}
+
+		validities = append(validities, &domesticCredentialValidity{cred, validFrom, validUntil})
+	}
+
+	return validities, nil
 }
 
 func unmarshalHolderSk(holderSkJson []byte) (*big.Int, error) {
 	holderSk := new(big.Int)
 	err := json.Unmarshal(holderSkJson, holderSk)
 	if err != nil {
-		return nil, errors.WrapPrefix(err, "Could not unmarshal holdercore sk", 0)
+		return nil, errors.WrapPrefix(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not unmarshal holdercore sk", 0)
 	}
 
 	return holderSk, nil
 }
 
+func unmarshalPrepareIssueMessage(prepareIssueMessageJson []byte) (*idemixcommon.PrepareIssueMessage, error) {
+	pim := &idemixcommon.PrepareIssueMessage{}
+	err := json.Unmarshal(prepareIssueMessageJson, pim)
+	if err != nil {
+		return nil, errors.WrapPrefix(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not JSON unmarshal prepare issue message", 0)
+	}
+
+	return pim, nil
+}
+
 func unmarshalCredential(credJson []byte) (*gabi.Credential, error) {
 	cred := new(gabi.Credential)
 	err := json.Unmarshal(credJson, cred)
 	if err != nil {
-		return nil, errors.WrapPrefix(err, "Could not unmarshal credential", 0)
+		return nil, errors.WrapPrefix(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not unmarshal credential", 0)
 	}
 
 	return cred, nil
@@ -158,7 +496,7 @@ func unmarshalCredential(credJson []byte) (*gabi.Credential, error) {
 func readCredentialWithVersion(cred *gabi.Credential) (map[string]string, error) {
 	attributes, credVersion, err := holder.ReadCredential(cred)
 	if err != nil {
-		return nil, errors.WrapPrefix(err, "Could not read credential", 0)
+		return nil, errors.WrapPrefix(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not read credential", 0)
 	}
 
 	// Add the credential version to the attributes
@@ -2,14 +2,36 @@ package mobilecore
 
 import (
 	"encoding/json"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
 	"time"
 )
 
+// StatementValidity is the validity window of a single statement of a European credential, as
+// unix timestamps. The valid until is the moment at which the statement expires, and zero when it
+// doesn't expire. A statement that will never be valid has the failure reason of the verifier.
+// The window is entirely zero when business rules replace the built-in rules.
+type StatementValidity struct {
+	Type          string `json:"type"`
+	ValidFrom     int64  `json:"validFrom"`
+	ValidUntil    int64  `json:"validUntil"`
+	FailureReason string `json:"failureReason"`
+}
+
 func ReadEuropeanCredential(proofPrefixed []byte) *Result {
+	return defaultHolder.ReadEuropeanCredential(proofPrefixed)
+}
+
+func (h *Holder) ReadEuropeanCredential(proofPrefixed []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
 	// Read the proof
-	hcert, err := europeanHolder.ReadQREncoded(proofPrefixed)
+	hcert, err := h.europeanHolder.ReadQREncoded(proofPrefixed)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not read European credential")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not read European credential")
 	}
 
 	// If the credential is a specimen, set the expirationTime to a year in the future
@@ -23,5 +45,81 @@ func ReadEuropeanCredential(proofPrefixed []byte) *Result {
 		return WrappedErrorResult(err, "Could not JSON marshal hcert")
 	}
 
-	return &Result{hcertJson, ""}
+	return &Result{hcertJson, "", ""}
+}
+
+// GetEuropeanValidity computes the validity window of every statement of a European credential,
+// with the same built-in rules as the verifier. The rules are the JSON European verification rules
+// of a config, or the rules of the holder config when empty. The value of the result is a JSON
+// list of statement validities.
+func GetEuropeanValidity(proofPrefixed []byte, rulesJson []byte) *Result {
+	return defaultHolder.GetEuropeanValidity(proofPrefixed, rulesJson)
+}
+
+func (h *Holder) GetEuropeanValidity(proofPrefixed []byte, rulesJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	rules := h.config.EuropeanVerificationRules
+	if len(rulesJson) != 0 {
+		var err error
+		rules, err = parseEuropeanVerificationRules(rulesJson)
+		if err != nil {
+			return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not parse European verification rules")
+		}
+	}
+
+	if rules == nil {
+		return ErrorResult(codedErrorf(ERROR_CODE_INVALID_CONFIG, "The holder config has no European verification rules"))
+	}
+
+	hcert, err := h.europeanHolder.ReadQREncoded(proofPrefixed)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not read European credential")
+	}
+
+	validitiesJson, err := json.Marshal(europeanStatementValidities(hcert.DCC, rules))
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal statement validities")
+	}
+
+	return &Result{validitiesJson, "", ""}
+}
+
+func europeanStatementValidities(dcc *hcertcommon.DCC, rules *europeanVerificationRules) []*StatementValidity {
+	validities := make([]*StatementValidity, 0, len(dcc.Vaccinations)+len(dcc.Tests)+len(dcc.Recoveries))
+	for _, vacc := range dcc.Vaccinations {
+		validFrom, validUntil, err := europeanStatementValidity(vacc, rules)
+		validities = append(validities, newStatementValidity(STATEMENT_TYPE_VACCINATION, validFrom, validUntil, err))
+	}
+
+	for _, test := range dcc.Tests {
+		validFrom, validUntil, err := europeanStatementValidity(test, rules)
+		validities = append(validities, newStatementValidity(STATEMENT_TYPE_TEST, validFrom, validUntil, err))
+	}
+
+	for _, rec := range dcc.Recoveries {
+		validFrom, validUntil, err := europeanStatementValidity(rec, rules)
+		validities = append(validities, newStatementValidity(STATEMENT_TYPE_RECOVERY, validFrom, validUntil, err))
+	}
+
+	return validities
+}
+
+func newStatementValidity(statementType string, validFrom, validUntil time.Time, err error) *StatementValidity {
+	if err != nil {
+		return &StatementValidity{
+			Type:          statementType,
+			FailureReason: getVerificationFailure(err).Reason,
+		}
+	}
+
+	return &StatementValidity{
+		Type:       statementType,
+		ValidFrom:  unixOrZero(validFrom),
+		ValidUntil: unixOrZero(validUntil),
+	}
 }
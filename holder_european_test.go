@@ -0,0 +1,118 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEuropeanValidity(t *testing.T) {
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	var config struct {
+		EuropeanVerificationRules json.RawMessage `json:"europeanVerificationRules"`
+	}
+
+	err = json.Unmarshal(configJson, &config)
+	if err != nil {
+		t.Fatal("Could not unmarshal config", err)
+	}
+
+	// The vaccination of the default QR is from 2021-07-10, and is valid after 14 days
+	r1 := GetEuropeanValidity(defaultQR, config.EuropeanVerificationRules)
+	if r1.Error != "" {
+		t.Fatal("Could not get European validity", r1.Error)
+	}
+
+	var validities []*StatementValidity
+	err = json.Unmarshal(r1.Value, &validities)
+	if err != nil {
+		t.Fatal("Could not unmarshal statement validities", err)
+	}
+
+	expectedValidity := StatementValidity{
+		Type:      STATEMENT_TYPE_VACCINATION,
+		ValidFrom: time.Date(2021, 7, 24, 0, 0, 0, 0, time.UTC).Unix(),
+	}
+
+	if len(validities) != 1 || *validities[0] != expectedValidity {
+		t.Fatal("Unexpected statement validities", string(r1.Value))
+	}
+
+	r2 := GetEuropeanValidity(defaultQR, []byte(`{"testValidityHours": 0}`))
+	if r2.ErrorCode != ERROR_CODE_INVALID_CONFIG {
+		t.Fatal("Expected an invalid config error for invalid rules, got", r2.ErrorCode)
+	}
+
+	// The holder should never disagree with the verifier around the edges of the validity windows
+	limitedRulesJson := strings.Replace(string(config.EuropeanVerificationRules), `"testValidityHours": 25,`, `"testValidityHours": 25, "vaccinationValidityDays": 270,`, 1)
+	for _, rulesJson := range []string{string(config.EuropeanVerificationRules), limitedRulesJson} {
+		rules, err := parseEuropeanVerificationRules([]byte(rulesJson))
+		if err != nil {
+			t.Fatal("Could not parse rules", err)
+		}
+
+		hcerts := []*hcertcommon.HealthCertificate{
+			getHcert("V", nil),
+			getHcert("V", vaccDoseChange(1, 2)),
+			getHcert("V", vaccDoseChange(3, 2)),
+			getHcert("V", vaccJanssen("2021-08-20")),
+			getHcert("T", nil),
+			getHcert("T", testChange("260373001", "TestResult")),
+			getHcert("R", nil),
+			getHcert("R", recChange("2021-06-20", "CertificateValidUntil")),
+		}
+
+		for i, hcert := range hcerts {
+			validity := europeanStatementValidities(hcert.DCC, rules)[0]
+			if validity.FailureReason != "" {
+				err = validateDCCStatements(hcert.DCC, rules, time.Unix(1627462000, 0))
+				if getVerificationFailure(err).Reason != validity.FailureReason {
+					t.Fatal("Expected the failure reason of the verifier for hcert", i)
+				}
+
+				continue
+			}
+
+			// The verification details show the same validity window
+			statement, err := buildEuropeanStatementDetails(hcert.DCC, rules)
+			if err != nil || statement.ValidFrom != validity.ValidFrom || statement.ValidUntil != validity.ValidUntil {
+				t.Fatal("Holder and verification details disagree on the validity window of hcert", i, err)
+			}
+
+			checkTimes := []int64{validity.ValidFrom - 1, validity.ValidFrom, validity.ValidFrom + 3600}
+			if validity.ValidUntil != 0 {
+				checkTimes = append(checkTimes, validity.ValidUntil-1, validity.ValidUntil+1)
+			}
+
+			for _, checkTime := range checkTimes {
+				expectValid := checkTime >= validity.ValidFrom && (validity.ValidUntil == 0 || checkTime < validity.ValidUntil)
+				err = validateDCCStatements(hcert.DCC, rules, time.Unix(checkTime, 0))
+				if (err == nil) != expectValid {
+					t.Fatal("Holder and verifier disagree for hcert", i, "at", checkTime, err)
+				}
+			}
+		}
+	}
+
+	// Business rules replace the built-in rules, so that neither knows the validity window
+	rules, err := parseEuropeanVerificationRules(config.EuropeanVerificationRules)
+	if err != nil {
+		t.Fatal("Could not parse rules", err)
+	}
+
+	rules.BusinessRules = []*BusinessRule{{Identifier: "VR-NL-0001", CertificateType: BUSINESS_RULE_CERTIFICATE_TYPE_VACCINATION}}
+	dcc := getHcert("V", nil).DCC
+
+	validity := europeanStatementValidities(dcc, rules)[0]
+	statement, err := buildEuropeanStatementDetails(dcc, rules)
+	if err != nil || validity.ValidFrom != 0 || validity.ValidUntil != 0 || statement.ValidFrom != 0 || statement.ValidUntil != 0 {
+		t.Fatal("Expected an unknown validity window with business rules", err)
+	}
+}
@@ -0,0 +1,203 @@
+package mobilecore
+
+import (
+	"github.com/go-errors/errors"
+	idemixcommon "github.com/minvws/nl-covid19-coronacheck-idemix/common"
+	idemixholder "github.com/minvws/nl-covid19-coronacheck-idemix/holder"
+	"github.com/privacybydesign/gabi"
+	"github.com/privacybydesign/gabi/big"
+)
+
+const ISSUANCE_SESSION_VERSION = 1
+
+// IssuanceSession contains the state that is needed to construct credentials after the
+// commitments have been sent to the issuer. It is serializable, so that multiple issuances
+// can be in flight at the same time and can be persisted across app restarts.
+// The holder secret key is deliberately not part of the session.
+//
+// The v' values are secrets of the holder as well: with them, the issued signatures can be linked
+// to the commitments. The session must therefore be stored as securely as the holder secret key,
+// and should be deleted as soon as the credentials have been created.
+type IssuanceSession struct {
+	Version     int        `json:"version"`
+	IssuerPkId  string     `json:"issuerPkId"`
+	HolderNonce *big.Int   `json:"holderNonce"`
+	VPrimes     []*big.Int `json:"vPrimes"`
+}
+
+// issuanceProofBuilder mimics gabi.CredentialBuilder (without random blind attributes and
+// keyshare support), with the difference that its vPrime value can be retrieved afterwards.
+// TestIssuanceProofBuilder checks that it stays in line with gabi's implementation.
+type issuanceProofBuilder struct {
+	pk     *gabi.PublicKey
+	secret *big.Int
+	vPrime *big.Int
+	u      *big.Int
+
+	uCommit      *big.Int
+	vPrimeCommit *big.Int
+	skRandomizer *big.Int
+}
+
+func (h *Holder) createCommitments(holderSk *big.Int, pim *idemixcommon.PrepareIssueMessage) (*IssuanceSession, *gabi.IssueCommitmentMessage, error) {
+	issuerPk, err := h.findIssuerPk(pim.IssuerPkId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	holderNonce := idemixcommon.GenerateNonce()
+
+	vPrimes := make([]*big.Int, 0, pim.CredentialAmount)
+	builders := make(gabi.ProofBuilderList, 0, pim.CredentialAmount)
+	for i := 0; i < pim.CredentialAmount; i++ {
+		builder := newIssuanceProofBuilder(issuerPk, holderSk)
+
+		vPrimes = append(vPrimes, builder.vPrime)
+		builders = append(builders, builder)
+	}
+
+	icm := &gabi.IssueCommitmentMessage{
+		Proofs: builders.BuildProofList(idemixcommon.BigOne, pim.IssuerNonce, false),
+		Nonce2: holderNonce,
+	}
+
+	session := &IssuanceSession{
+		Version:     ISSUANCE_SESSION_VERSION,
+		IssuerPkId:  pim.IssuerPkId,
+		HolderNonce: holderNonce,
+		VPrimes:     vPrimes,
+	}
+
+	return session, icm, nil
+}
+
+func (h *Holder) createCredentials(holderSk *big.Int, session *IssuanceSession, ccms []*idemixcommon.CreateCredentialMessage) ([]*gabi.Credential, error) {
+	if session.Version != ISSUANCE_SESSION_VERSION {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "Unsupported issuance session version %d", session.Version)
+	}
+
+	if session.HolderNonce == nil {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "The issuance session does not contain a holder nonce")
+	}
+
+	if len(ccms) > len(session.VPrimes) {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "More credentials are being issued than there are commitments in the issuance session")
+	}
+
+	issuerPk, err := h.findIssuerPk(session.IssuerPkId)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := make([]*gabi.Credential, 0, len(ccms))
+	for i, ccm := range ccms {
+		cred, err := constructCredential(issuerPk, holderSk, session.VPrimes[i], session.HolderNonce, ccm)
+		if err != nil {
+			return nil, errors.WrapPrefix(err, "Could not construct credential", 0)
+		}
+
+		creds = append(creds, cred)
+	}
+
+	return creds, nil
+}
+
+// constructCredential follows gabi.CredentialBuilder.ConstructCredential, using the state from the issuance session
+func constructCredential(pk *gabi.PublicKey, holderSk, vPrime, holderNonce *big.Int, ccm *idemixcommon.CreateCredentialMessage) (*gabi.Credential, error) {
+	ism := ccm.IssueSignatureMessage
+	if ism == nil || ism.Proof == nil || ism.Signature == nil || vPrime == nil {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "Incomplete create credential message or issuance session")
+	}
+
+	attributeInts, err := idemixcommon.ComputeAttributeInts(ccm.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ism.Proof.Verify(pk, ism.Signature, idemixcommon.BigOne, holderNonce) {
+		return nil, gabi.ErrIncorrectProofOfSignatureCorrectness
+	}
+
+	signature := &gabi.CLSignature{
+		A: ism.Signature.A,
+		E: ism.Signature.E,
+		V: new(big.Int).Add(ism.Signature.V, vPrime),
+	}
+
+	attributes := append([]*big.Int{holderSk}, attributeInts...)
+	if !signature.Verify(pk, attributes) {
+		return nil, gabi.ErrIncorrectAttributeSignature
+	}
+
+	cred := &gabi.Credential{
+		Pk:         pk,
+		Signature:  signature,
+		Attributes: attributes,
+	}
+
+	// Remove holder secret key from credential attributes
+	cred.Attributes[0] = nil
+
+	// Read credential to verify its version
+	_, version, err := idemixholder.ReadCredential(cred)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read freshly constructed credential", 0)
+	}
+
+	if version != idemixcommon.CredentialVersion {
+		return nil, errors.Errorf("Invalid credential version in freshly constructed credential")
+	}
+
+	return cred, nil
+}
+
+func newIssuanceProofBuilder(pk *gabi.PublicKey, secret *big.Int) *issuanceProofBuilder {
+	vPrime := idemixcommon.RandomBigInt(pk.Params.LvPrime)
+
+	// U = S^{vPrime} * R0^{secret}
+	u := new(big.Int).Exp(pk.S, vPrime, pk.N)
+	u.Mul(u, new(big.Int).Exp(pk.R[0], secret, pk.N))
+	u.Mod(u, pk.N)
+
+	return &issuanceProofBuilder{
+		pk:      pk,
+		secret:  secret,
+		vPrime:  vPrime,
+		u:       u,
+		uCommit: big.NewInt(1),
+	}
+}
+
+func (b *issuanceProofBuilder) Commit(randomizers map[string]*big.Int) []*big.Int {
+	b.skRandomizer = randomizers["secretkey"]
+	b.vPrimeCommit = idemixcommon.RandomBigInt(b.pk.Params.LvPrimeCommit)
+
+	// U_commit = U_commit * S^{v_prime_commit} * R_0^{s_commit}
+	sv := new(big.Int).Exp(b.pk.S, b.vPrimeCommit, b.pk.N)
+	r0s := new(big.Int).Exp(b.pk.R[0], b.skRandomizer, b.pk.N)
+	b.uCommit.Mul(b.uCommit, sv).Mul(b.uCommit, r0s)
+	b.uCommit.Mod(b.uCommit, b.pk.N)
+
+	return []*big.Int{b.u, b.uCommit}
+}
+
+func (b *issuanceProofBuilder) CreateProof(challenge *big.Int) gabi.Proof {
+	sResponse := new(big.Int).Add(b.skRandomizer, new(big.Int).Mul(challenge, b.secret))
+	vPrimeResponse := new(big.Int).Add(b.vPrimeCommit, new(big.Int).Mul(challenge, b.vPrime))
+
+	return &gabi.ProofU{
+		U:              b.u,
+		C:              challenge,
+		VPrimeResponse: vPrimeResponse,
+		SResponse:      sResponse,
+		MUserResponses: map[int]*big.Int{},
+	}
+}
+
+func (b *issuanceProofBuilder) PublicKey() *gabi.PublicKey {
+	return b.pk
+}
+
+// Keyshare servers are not used for these credentials, so there is nothing to merge
+func (b *issuanceProofBuilder) MergeProofPCommitment(_ *gabi.ProofPCommitment) {
+}
@@ -0,0 +1,40 @@
+package mobilecore
+
+// disclosurePolicy determines which attributes of a domestic credential are hidden when disclosing,
+// for contexts that don't need to check the identity of the holder
+type disclosurePolicy struct {
+	Identifier       string   `json:"id"`
+	HiddenAttributes []string `json:"hiddenAttributes"`
+}
+
+func (config *holderConfiguration) findDisclosurePolicy(policyId string) (*disclosurePolicy, error) {
+	for _, policy := range config.DomesticDisclosurePolicies {
+		if policy.Identifier == policyId {
+			return policy, nil
+		}
+	}
+
+	return nil, codedErrorf(ERROR_CODE_INVALID_CONFIG, "Disclosure policy '%s' is not part of the config", policyId)
+}
+
+func validateDisclosurePolicies(policies []*disclosurePolicy, addIssue func(field string, format string, a ...interface{})) {
+	policyIds := map[string]bool{}
+	for _, policy := range policies {
+		if policy == nil || policy.Identifier == "" {
+			addIssue("domesticDisclosurePolicies", "Should not contain a policy without identifier")
+			continue
+		}
+
+		if policyIds[policy.Identifier] {
+			addIssue("domesticDisclosurePolicies", "Policy %s is present more than once", policy.Identifier)
+		}
+
+		policyIds[policy.Identifier] = true
+
+		for _, hiddenAttribute := range policy.HiddenAttributes {
+			if !hideableDomesticAttributes[hiddenAttribute] {
+				addIssue("domesticDisclosurePolicies", "Policy %s cannot hide attribute '%s'", policy.Identifier, hiddenAttribute)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// RefreshPlan tells when new domestic credentials should be fetched from the issuer, with unix
+// timestamps. The credentials cover the time from now until covered until without interruption,
+// which is zero when no credential is valid now. The gaps are the periods after now, until the
+// last credential expires, in which no credential is valid. Without credentials that are valid
+// after now, all are zero.
+type RefreshPlan struct {
+	CoveredUntil   int64          `json:"coveredUntil"`
+	LastValidUntil int64          `json:"lastValidUntil"`
+	Gaps           []*CoverageGap `json:"gaps"`
+	ShouldRefresh  bool           `json:"shouldRefresh"`
+}
+
+type CoverageGap struct {
+	From  int64 `json:"from"`
+	Until int64 `json:"until"`
+}
+
+// PlanDomesticRefresh inspects the given JSON list of stored domestic credentials, and plans their
+// refresh according to the refresh threshold of the holder config. The value of the result is the
+// JSON refresh plan.
+func PlanDomesticRefresh(credentialsJson []byte, nowUnix int64) *Result {
+	return defaultHolder.PlanDomesticRefresh(credentialsJson, nowUnix)
+}
+
+func (h *Holder) PlanDomesticRefresh(credentialsJson []byte, nowUnix int64) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	validities, err := readDomesticValidities(credentialsJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	threshold := time.Duration(h.config.DomesticCredentialRefreshThresholdHours) * time.Hour
+	plan := planDomesticRefresh(validities, threshold, time.Unix(nowUnix, 0))
+
+	planJson, err := json.Marshal(plan)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal refresh plan")
+	}
+
+	return &Result{planJson, "", ""}
+}
+
+// planDomesticRefresh walks through the validity windows in order of valid from, and should
+// refresh when the uninterrupted coverage from now is shorter than the threshold. A zero
+// threshold disables refreshing.
+func planDomesticRefresh(validities []*domesticCredentialValidity, threshold time.Duration, now time.Time) *RefreshPlan {
+	sorted := make([]*domesticCredentialValidity, len(validities))
+	copy(sorted, validities)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].validFrom.Before(sorted[j].validFrom)
+	})
+
+	plan := &RefreshPlan{
+		Gaps: []*CoverageGap{},
+	}
+
+	coveredUntil := now
+	for _, validity := range sorted {
+		if !validity.validUntil.After(coveredUntil) {
+			continue
+		}
+
+		// Only credentials that are still valid after now count as last valid until
+		plan.LastValidUntil = validity.validUntil.Unix()
+
+		if validity.validFrom.After(coveredUntil) {
+			plan.Gaps = append(plan.Gaps, &CoverageGap{
+				From:  coveredUntil.Unix(),
+				Until: validity.validFrom.Unix(),
+			})
+		}
+
+		coveredUntil = validity.validUntil
+		if len(plan.Gaps) == 0 {
+			plan.CoveredUntil = coveredUntil.Unix()
+		}
+	}
+
+	coverage := time.Duration(0)
+	if plan.CoveredUntil != 0 {
+		coverage = time.Unix(plan.CoveredUntil, 0).Sub(now)
+	}
+
+	plan.ShouldRefresh = threshold != 0 && coverage < threshold
+
+	return plan
+}
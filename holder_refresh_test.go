@@ -0,0 +1,87 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestRefreshPlan(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+	window := func(fromHours, untilHours int) *domesticCredentialValidity {
+		return &domesticCredentialValidity{
+			validFrom:  now.Add(time.Duration(fromHours) * time.Hour),
+			validUntil: now.Add(time.Duration(untilHours) * time.Hour),
+		}
+	}
+
+	hours := func(h int) int64 {
+		return now.Add(time.Duration(h) * time.Hour).Unix()
+	}
+
+	testCases := []struct {
+		validities     []*domesticCredentialValidity
+		coveredUntil   int64
+		lastValidUntil int64
+		gaps           []CoverageGap
+		shouldRefresh  bool
+	}{
+		// Overlapping credentials, in any order, cover the time without gaps
+		{[]*domesticCredentialValidity{window(24, 64), window(-24, 16), window(0, 40)}, hours(64), hours(64), nil, false},
+
+		// A gap between the credentials limits the coverage
+		{[]*domesticCredentialValidity{window(-24, 16), window(24, 64)}, hours(16), hours(64), []CoverageGap{{hours(16), hours(24)}}, true},
+
+		// Not yet covered now
+		{[]*domesticCredentialValidity{window(2, 42)}, 0, hours(42), []CoverageGap{{hours(0), hours(2)}}, true},
+
+		// Only expired credentials
+		{[]*domesticCredentialValidity{window(-48, -8)}, 0, 0, nil, true},
+		{[]*domesticCredentialValidity{window(-24, 0), window(-72, -32), window(-48, -8)}, 0, 0, nil, true},
+
+		// An expired credential doesn't affect the last valid until of valid credentials
+		{[]*domesticCredentialValidity{window(-24, 16), window(-72, -32)}, hours(16), hours(16), nil, true},
+
+		// Without credentials
+		{nil, 0, 0, nil, true},
+	}
+
+	for i, testCase := range testCases {
+		plan := planDomesticRefresh(testCase.validities, 24*time.Hour, now)
+		if plan.CoveredUntil != testCase.coveredUntil || plan.LastValidUntil != testCase.lastValidUntil || plan.ShouldRefresh != testCase.shouldRefresh {
+			t.Fatal("Unexpected refresh plan for test case", i, *plan)
+		}
+
+		if len(plan.Gaps) != len(testCase.gaps) {
+			t.Fatal("Expected", len(testCase.gaps), "gaps for test case", i, "but got", len(plan.Gaps))
+		}
+
+		for j, gap := range testCase.gaps {
+			if *plan.Gaps[j] != gap {
+				t.Fatal("Unexpected gap for test case", i, *plan.Gaps[j])
+			}
+		}
+	}
+
+	// A zero threshold disables refreshing
+	plan := planDomesticRefresh(nil, 0, now)
+	if plan.ShouldRefresh {
+		t.Fatal("Expected no refresh with a zero threshold")
+	}
+
+	// The threshold of the test holder config is zero
+	r1 := GenerateHolderSk()
+	credsJson := issueTestCredentials(t, r1.Value, buildCredentialsAttributes(3))
+	credentialsJson := []byte("[" + string(credsJson[0]) + "," + string(credsJson[1]) + "," + string(credsJson[2]) + "]")
+
+	r2 := PlanDomesticRefresh(credentialsJson, time.Now().Unix())
+	if r2.Error != "" {
+		t.Fatal("Could not plan refresh", r2.Error)
+	}
+
+	var resultPlan *RefreshPlan
+	err := json.Unmarshal(r2.Value, &resultPlan)
+	if err != nil || resultPlan.CoveredUntil == 0 || resultPlan.ShouldRefresh {
+		t.Fatal("Unexpected refresh plan for issued credentials", string(r2.Value))
+	}
+}
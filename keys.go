@@ -1,11 +1,13 @@
 package mobilecore
 
 import (
+	"bytes"
 	"encoding/json"
 	"github.com/go-errors/errors"
 	hcertverifier "github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
 	"github.com/privacybydesign/gabi"
 	"os"
+	"sync"
 )
 
 type PublicKeysConfig struct {
@@ -14,6 +16,9 @@ type PublicKeysConfig struct {
 
 	// DEPRECATED: Remove this struct when the transition to nl_keys is complete
 	LegacyDomesticPks []*AnnotatedDomesticPk `json:"cl_keys"`
+
+	// Guards the lazily loaded public keys, as these can be used by concurrent verifications
+	domesticPksLock sync.Mutex
 }
 
 type DomesticPksLookup map[string]*AnnotatedDomesticPk
@@ -32,12 +37,20 @@ func NewPublicKeysConfig(pksPath string, expectEuropeanKeys bool) (*PublicKeysCo
 		return nil, errors.WrapPrefix(err, "Could not read public keys file", 0)
 	}
 
+	return NewPublicKeysConfigFromJson(pksJson, expectEuropeanKeys)
+}
+
+func NewPublicKeysConfigFromJson(pksJson []byte, expectEuropeanKeys bool) (*PublicKeysConfig, error) {
 	var publicKeysConfig *PublicKeysConfig
-	err = json.Unmarshal(pksJson, &publicKeysConfig)
+	err := json.Unmarshal(pksJson, &publicKeysConfig)
 	if err != nil {
 		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal public keys", 0)
 	}
 
+	if publicKeysConfig == nil {
+		return nil, errors.Errorf("The public keys config was empty")
+	}
+
 	publicKeysConfig.TransformLegacyDomesticPks()
 
 	if publicKeysConfig.DomesticPks == nil {
@@ -64,10 +77,16 @@ func (pkc *PublicKeysConfig) TransformLegacyDomesticPks() {
 }
 
 func (pkc *PublicKeysConfig) FindAndCacheDomestic(kid string) (*gabi.PublicKey, error) {
+	pkc.domesticPksLock.Lock()
+	defer pkc.domesticPksLock.Unlock()
+
 	// Check if key id is present
 	annotatedPk, ok := pkc.DomesticPks[kid]
 	if !ok {
-		return nil, errors.Errorf("Could not find domestic public key")
+		// The key lookup is shared by the verifier and holder, so the error carries both a
+		// failure reason and an error code
+		err := failuref(FAILURE_REASON_UNKNOWN_KEY, "Could not find domestic public key")
+		return nil, withErrorCode(err, ERROR_CODE_UNKNOWN_PUBLIC_KEY)
 	}
 
 	// Ensure the public key is cached
@@ -81,3 +100,35 @@ func (pkc *PublicKeysConfig) FindAndCacheDomestic(kid string) (*gabi.PublicKey,
 
 	return annotatedPk.LoadedPk, nil
 }
+
+// takeOverLoadedDomesticPks reuses the already loaded public keys of a previous config,
+// for all keys that are present with exactly the same XML in this config.
+// Only one of both locks is held at a time, so that concurrent take overs cannot deadlock.
+func (pkc *PublicKeysConfig) takeOverLoadedDomesticPks(previous *PublicKeysConfig) {
+	if previous == nil || previous == pkc {
+		return
+	}
+
+	previous.domesticPksLock.Lock()
+	previousLoadedPks := make(map[string]AnnotatedDomesticPk, len(previous.DomesticPks))
+	for kid, previousAnnotatedPk := range previous.DomesticPks {
+		if previousAnnotatedPk != nil && previousAnnotatedPk.LoadedPk != nil {
+			previousLoadedPks[kid] = *previousAnnotatedPk
+		}
+	}
+	previous.domesticPksLock.Unlock()
+
+	pkc.domesticPksLock.Lock()
+	defer pkc.domesticPksLock.Unlock()
+
+	for kid, annotatedPk := range pkc.DomesticPks {
+		previousAnnotatedPk, ok := previousLoadedPks[kid]
+		if !ok || annotatedPk == nil || annotatedPk.LoadedPk != nil {
+			continue
+		}
+
+		if bytes.Equal(annotatedPk.PkXml, previousAnnotatedPk.PkXml) {
+			annotatedPk.LoadedPk = previousAnnotatedPk.LoadedPk
+		}
+	}
+}
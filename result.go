@@ -1,10 +1,31 @@
 package mobilecore
 
-import "github.com/go-errors/errors"
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+)
+
+// Error codes of a Result, so that the apps can decide whether to retry, re-fetch the
+// public keys or ask the user to re-issue, without matching on the error string
+const (
+	ERROR_CODE_UNKNOWN             = "UNKNOWN"
+	ERROR_CODE_INTERNAL_ERROR      = "INTERNAL_ERROR"
+	ERROR_CODE_NOT_INITIALIZED     = "NOT_INITIALIZED"
+	ERROR_CODE_INVALID_CONFIG      = "INVALID_CONFIG"
+	ERROR_CODE_INVALID_SIGNATURE   = "INVALID_SIGNATURE"
+	ERROR_CODE_MALFORMED_INPUT     = "MALFORMED_INPUT"
+	ERROR_CODE_UNKNOWN_PUBLIC_KEY  = "UNKNOWN_PUBLIC_KEY"
+	ERROR_CODE_NO_PENDING_ISSUANCE = "NO_PENDING_ISSUANCE"
+	ERROR_CODE_ISSUANCE_FAILED     = "ISSUANCE_FAILED"
+	ERROR_CODE_CREDENTIAL_EXPIRED  = "CREDENTIAL_EXPIRED"
+	ERROR_CODE_DECRYPTION_FAILED   = "DECRYPTION_FAILED"
+	ERROR_CODE_WALLET_FULL         = "WALLET_FULL"
+)
 
 type Result struct {
-	Value []byte
-	Error string
+	Value     []byte
+	Error     string
+	ErrorCode string
 }
 
 func WrappedErrorResult(err error, prefix string) *Result {
@@ -20,5 +41,61 @@ func ErrorResult(err error) *Result {
 		panic("Assertion failed: error should not be nil")
 	}
 
-	return &Result{nil, err.Error()}
+	return &Result{nil, err.Error(), getErrorCode(err)}
+}
+
+// recoverResult turns an unexpected panic into an error result, as a panic
+// would otherwise crash the app across the gomobile boundary
+func recoverResult(result **Result) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	*result = ErrorResult(codedErrorf(ERROR_CODE_INTERNAL_ERROR, "Unexpected error: %v", r))
+}
+
+// codedError carries the error code through the (prefix) wrapped error chain. When it is
+// attached to an existing error, that error remains part of the chain.
+type codedError struct {
+	code    string
+	message string
+	err     error
+}
+
+func (ce *codedError) Error() string {
+	return ce.message
+}
+
+func (ce *codedError) Unwrap() error {
+	return ce.err
+}
+
+func codedErrorf(code string, format string, a ...interface{}) *errors.Error {
+	return errors.Wrap(&codedError{
+		code:    code,
+		message: fmt.Sprintf(format, a...),
+	}, 1)
+}
+
+// withErrorCode attaches an error code to an error that doesn't have one yet
+func withErrorCode(err error, code string) error {
+	if getErrorCode(err) != ERROR_CODE_UNKNOWN {
+		return err
+	}
+
+	return errors.Wrap(&codedError{
+		code:    code,
+		message: err.Error(),
+		err:     err,
+	}, 1)
+}
+
+func getErrorCode(err error) string {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+
+	return ERROR_CODE_UNKNOWN
 }
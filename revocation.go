@@ -0,0 +1,310 @@
+package mobilecore
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
+)
+
+const REVOCATION_LISTS_FILENAME = "revocation_lists.json"
+
+// The kinds of hashes in a revocation list. The European hash types follow the EU DCC revocation
+// specification, and the domestic hash type revokes (paper) proofs by their proof identifier.
+const (
+	REVOCATION_HASH_TYPE_UCI              = "UCI"
+	REVOCATION_HASH_TYPE_COUNTRY_CODE_UCI = "COUNTRYCODEUCI"
+	REVOCATION_HASH_TYPE_SIGNATURE        = "SIGNATURE"
+	REVOCATION_HASH_TYPE_PROOF_IDENTIFIER = "PROOF_IDENTIFIER"
+)
+
+const (
+	REVOCATION_HASH_SIZE                   = 16
+	REVOCATION_BLOOM_FILTER_MAX_HASH_COUNT = 32
+
+	// The COSE algorithm identifier of ECDSA with SHA-256
+	COSE_ALGORITHM_ES256 = -7
+)
+
+// RevocationChunk is a part of the revocation list of a single key and hash type. The key is the
+// base64 encoded key identifier for European proofs, and the issuer public key identifier for
+// domestic proofs. Every hash is the base64 encoded first 16 bytes of the SHA-256 digest of the
+// revoked value. A chunk contains either a list of these hashes, or a bloom filter of them.
+//
+// An update replaces the loaded chunk with the same key, hash type and identifier, or empties it
+// when marked as deleted. Updates that are older than the loaded (or deleted) chunk are ignored.
+type RevocationChunk struct {
+	Kid         string                 `json:"kid"`
+	HashType    string                 `json:"hashType"`
+	Id          string                 `json:"id"`
+	LastUpdated int64                  `json:"lastUpdated"`
+	Deleted     bool                   `json:"deleted"`
+	Hashes      []string               `json:"hashes"`
+	BloomFilter *RevocationBloomFilter `json:"bloomFilter"`
+}
+
+// RevocationBloomFilter contains the base64 encoded bits of a bloom filter. The bit indices of a
+// hash are derived from the SHA-256 digest of that hash, of which the first and second 8 bytes are
+// big endian integers h1 and h2, as (h1 + i * h2) modulo the amount of bits, for i below the hash
+// count. Bloom filters can report false positives, which is accepted for the sake of their size.
+type RevocationBloomFilter struct {
+	Bits      string `json:"bits"`
+	HashCount int    `json:"hashCount"`
+}
+
+// RevocationLists are the loaded revocation chunks, partitioned by key and hash type. They are
+// never modified after loading, so that an update results in new revocation lists.
+type RevocationLists struct {
+	partitions map[revocationPartition]map[string]*loadedRevocationChunk
+}
+
+type revocationPartition struct {
+	kid      string
+	hashType string
+}
+
+// loadedRevocationChunk is either a list of hashes or a bloom filter. A deleted chunk is kept
+// without either, so that its last updated time still applies to later updates.
+type loadedRevocationChunk struct {
+	lastUpdated int64
+	deleted     bool
+	hashes      map[[REVOCATION_HASH_SIZE]byte]bool
+	bloomBits   []byte
+	bloomHashes int
+}
+
+// NewRevocationListsFromJson loads a JSON list of revocation chunks
+func NewRevocationListsFromJson(revocationListsJson []byte) (*RevocationLists, error) {
+	chunks, err := unmarshalRevocationChunks(revocationListsJson)
+	if err != nil {
+		return nil, err
+	}
+
+	return (&RevocationLists{}).update(chunks)
+}
+
+func unmarshalRevocationChunks(revocationChunksJson []byte) ([]*RevocationChunk, error) {
+	var chunks []*RevocationChunk
+	err := json.Unmarshal(revocationChunksJson, &chunks)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal revocation chunks", 0)
+	}
+
+	return chunks, nil
+}
+
+// update returns new revocation lists with the given chunks applied, leaving these lists as is
+func (rl *RevocationLists) update(chunks []*RevocationChunk) (*RevocationLists, error) {
+	updated := &RevocationLists{
+		partitions: map[revocationPartition]map[string]*loadedRevocationChunk{},
+	}
+
+	if rl != nil {
+		for partition, loadedChunks := range rl.partitions {
+			updated.partitions[partition] = loadedChunks
+		}
+	}
+
+	// Partitions are copied before their first change, as they may be shared with the previous lists
+	copied := map[revocationPartition]bool{}
+	for _, chunk := range chunks {
+		loadedChunk, err := loadRevocationChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		partition := revocationPartition{chunk.Kid, chunk.HashType}
+		current, ok := updated.partitions[partition][chunk.Id]
+		if ok && current.lastUpdated > chunk.LastUpdated {
+			continue
+		}
+
+		if !copied[partition] {
+			loadedChunks := map[string]*loadedRevocationChunk{}
+			for id, c := range updated.partitions[partition] {
+				loadedChunks[id] = c
+			}
+
+			updated.partitions[partition] = loadedChunks
+			copied[partition] = true
+		}
+
+		updated.partitions[partition][chunk.Id] = loadedChunk
+	}
+
+	return updated, nil
+}
+
+func loadRevocationChunk(chunk *RevocationChunk) (*loadedRevocationChunk, error) {
+	if chunk == nil || chunk.Kid == "" || chunk.Id == "" {
+		return nil, errors.Errorf("Every revocation chunk should have a key identifier and chunk identifier")
+	}
+
+	switch chunk.HashType {
+	case REVOCATION_HASH_TYPE_UCI, REVOCATION_HASH_TYPE_COUNTRY_CODE_UCI, REVOCATION_HASH_TYPE_SIGNATURE, REVOCATION_HASH_TYPE_PROOF_IDENTIFIER:
+	default:
+		return nil, errors.Errorf("Revocation chunk %s has unknown hash type '%s'", chunk.Id, chunk.HashType)
+	}
+
+	if chunk.Deleted {
+		return &loadedRevocationChunk{lastUpdated: chunk.LastUpdated, deleted: true}, nil
+	}
+
+	if (chunk.Hashes == nil) == (chunk.BloomFilter == nil) {
+		return nil, errors.Errorf("Revocation chunk %s should contain either hashes or a bloom filter", chunk.Id)
+	}
+
+	loadedChunk := &loadedRevocationChunk{
+		lastUpdated: chunk.LastUpdated,
+	}
+
+	if chunk.BloomFilter != nil {
+		bits, err := base64.StdEncoding.DecodeString(chunk.BloomFilter.Bits)
+		if err != nil || len(bits) == 0 {
+			return nil, errors.Errorf("Revocation chunk %s has invalid bloom filter bits", chunk.Id)
+		}
+
+		hashCount := chunk.BloomFilter.HashCount
+		if hashCount <= 0 || hashCount > REVOCATION_BLOOM_FILTER_MAX_HASH_COUNT {
+			return nil, errors.Errorf("Revocation chunk %s has invalid bloom filter hash count %d", chunk.Id, hashCount)
+		}
+
+		loadedChunk.bloomBits = bits
+		loadedChunk.bloomHashes = hashCount
+
+		return loadedChunk, nil
+	}
+
+	loadedChunk.hashes = make(map[[REVOCATION_HASH_SIZE]byte]bool, len(chunk.Hashes))
+	for _, hashBase64 := range chunk.Hashes {
+		hash, err := base64.StdEncoding.DecodeString(hashBase64)
+		if err != nil || len(hash) != REVOCATION_HASH_SIZE {
+			return nil, errors.Errorf("Revocation chunk %s has invalid hash '%s'", chunk.Id, hashBase64)
+		}
+
+		var key [REVOCATION_HASH_SIZE]byte
+		copy(key[:], hash)
+		loadedChunk.hashes[key] = true
+	}
+
+	return loadedChunk, nil
+}
+
+// isRevoked checks whether the hash of the given value is present in any chunk of the partition
+func (rl *RevocationLists) isRevoked(kid, hashType string, value []byte) bool {
+	if rl == nil {
+		return false
+	}
+
+	hash := revocationHash(value)
+	for _, chunk := range rl.partitions[revocationPartition{kid, hashType}] {
+		if chunk.contains(hash) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (chunk *loadedRevocationChunk) contains(hash [REVOCATION_HASH_SIZE]byte) bool {
+	if chunk.deleted {
+		return false
+	}
+
+	if chunk.bloomBits == nil {
+		return chunk.hashes[hash]
+	}
+
+	digest := sha256.Sum256(hash[:])
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16])
+	bitAmount := uint64(len(chunk.bloomBits)) * 8
+
+	for i := 0; i < chunk.bloomHashes; i++ {
+		bitIndex := (h1 + uint64(i)*h2) % bitAmount
+		if chunk.bloomBits[bitIndex/8]&(1<<(bitIndex%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func revocationHash(value []byte) (hash [REVOCATION_HASH_SIZE]byte) {
+	digest := sha256.Sum256(value)
+	copy(hash[:], digest[:REVOCATION_HASH_SIZE])
+
+	return hash
+}
+
+// checkDomesticRevocation checks the proof identifier of a (paper) proof against the revocation
+// list of its issuer public key
+func (rl *RevocationLists) checkDomesticRevocation(verifiedCred *idemixverifier.VerifiedCredential) error {
+	if rl.isRevoked(verifiedCred.IssuerPkId, REVOCATION_HASH_TYPE_PROOF_IDENTIFIER, verifiedCred.ProofIdentifier) {
+		return failuref(FAILURE_REASON_REVOKED, "The proof identifier is present in the revocation list")
+	}
+
+	return nil
+}
+
+// checkEuropeanRevocation checks the certificate identifiers and the signature of a verified
+// European QR code against the revocation lists of its key identifier
+func (rl *RevocationLists) checkEuropeanRevocation(proofQREncoded []byte, hcert *hcertcommon.HealthCertificate) error {
+	if rl == nil {
+		return nil
+	}
+
+	cwt, err := hcertcommon.UnmarshalQREncoded(proofQREncoded)
+	if err != nil {
+		return err
+	}
+
+	kid, alg, err := readEuropeanCWTHeader(cwt)
+	if err != nil {
+		return err
+	}
+
+	kidBase64 := base64.StdEncoding.EncodeToString(kid)
+
+	// The country code is that of the statement itself, which is not necessarily the issuer
+	type statementIdentifier struct {
+		countryCode string
+		uci         string
+	}
+
+	var identifiers []statementIdentifier
+	for _, vacc := range hcert.DCC.Vaccinations {
+		identifiers = append(identifiers, statementIdentifier{vacc.CountryOfVaccination, vacc.CertificateIdentifier})
+	}
+
+	for _, test := range hcert.DCC.Tests {
+		identifiers = append(identifiers, statementIdentifier{test.CountryOfVaccination, test.CertificateIdentifier})
+	}
+
+	for _, rec := range hcert.DCC.Recoveries {
+		identifiers = append(identifiers, statementIdentifier{rec.CountryOfTest, rec.CertificateIdentifier})
+	}
+
+	for _, identifier := range identifiers {
+		if rl.isRevoked(kidBase64, REVOCATION_HASH_TYPE_UCI, []byte(identifier.uci)) ||
+			rl.isRevoked(kidBase64, REVOCATION_HASH_TYPE_COUNTRY_CODE_UCI, []byte(identifier.countryCode+identifier.uci)) {
+			return failuref(FAILURE_REASON_REVOKED, "The certificate identifier is present in the revocation list")
+		}
+	}
+
+	// For ECDSA signatures only the r value is hashed, as the s value can be changed without
+	// invalidating the signature
+	signature := cwt.Signature
+	if alg == COSE_ALGORITHM_ES256 {
+		signature = signature[:len(signature)/2]
+	}
+
+	if rl.isRevoked(kidBase64, REVOCATION_HASH_TYPE_SIGNATURE, signature) {
+		return failuref(FAILURE_REASON_REVOKED, "The signature is present in the revocation list")
+	}
+
+	return nil
+}
@@ -0,0 +1,254 @@
+package mobilecore
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestEuropeanRevocation(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+	v := newRevocationTestVerifier(t)
+
+	cwt, err := hcertcommon.UnmarshalQREncoded(defaultQR)
+	if err != nil {
+		t.Fatal("Could not unmarshal QR", err)
+	}
+
+	hcert, err := hcertcommon.ReadCWT(cwt)
+	if err != nil {
+		t.Fatal("Could not read CWT", err)
+	}
+
+	kid, alg, err := readEuropeanCWTHeader(cwt)
+	if err != nil {
+		t.Fatal("Could not read CWT header", err)
+	}
+
+	kidBase64 := base64.StdEncoding.EncodeToString(kid)
+	uci := hcert.DCC.Vaccinations[0].CertificateIdentifier
+
+	r1 := v.verify(defaultQR, now)
+	if r1.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Expected success without revocation lists", r1.Error)
+	}
+
+	// Revoke by certificate identifier
+	err = v.UpdateRevocationLists([]*RevocationChunk{
+		{Kid: kidBase64, HashType: REVOCATION_HASH_TYPE_UCI, Id: "a", LastUpdated: 10, Hashes: []string{testRevocationHash([]byte(uci))}},
+	})
+	if err != nil {
+		t.Fatal("Could not update revocation lists", err)
+	}
+
+	r2 := v.verify(defaultQR, now)
+	if r2.Failure == nil || r2.Failure.Reason != FAILURE_REASON_REVOKED {
+		t.Fatal("Expected the certificate identifier to be revoked")
+	}
+
+	// An older version of the chunk is ignored, but a newer deletion is applied
+	err = v.UpdateRevocationLists([]*RevocationChunk{
+		{Kid: kidBase64, HashType: REVOCATION_HASH_TYPE_UCI, Id: "a", LastUpdated: 5, Hashes: []string{}},
+	})
+	if err != nil {
+		t.Fatal("Could not update revocation lists", err)
+	}
+
+	r3 := v.verify(defaultQR, now)
+	if r3.Failure == nil || r3.Failure.Reason != FAILURE_REASON_REVOKED {
+		t.Fatal("Expected an older chunk to be ignored")
+	}
+
+	err = v.UpdateRevocationLists([]*RevocationChunk{
+		{Kid: kidBase64, HashType: REVOCATION_HASH_TYPE_UCI, Id: "a", LastUpdated: 20, Deleted: true},
+	})
+	if err != nil {
+		t.Fatal("Could not update revocation lists", err)
+	}
+
+	r4 := v.verify(defaultQR, now)
+	if r4.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Expected success after deleting the chunk", r4.Error)
+	}
+
+	// A deleted chunk still ignores updates that are older than its deletion
+	err = v.UpdateRevocationLists([]*RevocationChunk{
+		{Kid: kidBase64, HashType: REVOCATION_HASH_TYPE_UCI, Id: "a", LastUpdated: 15, Hashes: []string{testRevocationHash([]byte(uci))}},
+	})
+	if err != nil {
+		t.Fatal("Could not update revocation lists", err)
+	}
+
+	r7 := v.verify(defaultQR, now)
+	if r7.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Expected an update older than the deletion to be ignored", r7.Error)
+	}
+
+	// Revoke by the country of vaccination and certificate identifier
+	countryCodeUci := hcert.DCC.Vaccinations[0].CountryOfVaccination + uci
+	err = v.UpdateRevocationLists([]*RevocationChunk{
+		{Kid: kidBase64, HashType: REVOCATION_HASH_TYPE_COUNTRY_CODE_UCI, Id: "c", LastUpdated: 10, Hashes: []string{testRevocationHash([]byte(countryCodeUci))}},
+	})
+	if err != nil {
+		t.Fatal("Could not update revocation lists", err)
+	}
+
+	r8 := v.verify(defaultQR, now)
+	if r8.Failure == nil || r8.Failure.Reason != FAILURE_REASON_REVOKED {
+		t.Fatal("Expected the country code and certificate identifier to be revoked")
+	}
+
+	err = v.ReplaceRevocationLists(nil)
+	if err != nil {
+		t.Fatal("Could not replace revocation lists", err)
+	}
+
+	// Revoke by the r value of the signature, through a bloom filter
+	signature := cwt.Signature
+	if alg == COSE_ALGORITHM_ES256 {
+		signature = signature[:len(signature)/2]
+	}
+
+	err = v.UpdateRevocationLists([]*RevocationChunk{
+		{Kid: kidBase64, HashType: REVOCATION_HASH_TYPE_SIGNATURE, Id: "b", BloomFilter: testBloomFilter(revocationHash(signature))},
+	})
+	if err != nil {
+		t.Fatal("Could not update revocation lists", err)
+	}
+
+	r5 := v.verify(defaultQR, now)
+	if r5.Failure == nil || r5.Failure.Reason != FAILURE_REASON_REVOKED {
+		t.Fatal("Expected the signature to be revoked")
+	}
+
+	// Revocations of other keys don't apply
+	otherKidLists, err := NewRevocationListsFromJson([]byte(`[
+		{"kid": "b3RoZXI=", "hashType": "COUNTRYCODEUCI", "id": "c", "hashes": ["` + testRevocationHash([]byte(countryCodeUci)) + `"]}
+	]`))
+	if err != nil {
+		t.Fatal("Could not load revocation lists", err)
+	}
+
+	err = v.ReplaceRevocationLists(otherKidLists)
+	if err != nil {
+		t.Fatal("Could not replace revocation lists", err)
+	}
+
+	r6 := v.verify(defaultQR, now)
+	if r6.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Expected success with revocations of another key", r6.Error)
+	}
+}
+
+func TestDomesticRevocation(t *testing.T) {
+	v := newRevocationTestVerifier(t)
+
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key:", r1.Error)
+	}
+
+	credsJson := issueTestCredentials(t, r1.Value, buildCredentialsAttributes(1))
+	r2 := Disclose(r1.Value, credsJson[0])
+	if r2.Error != "" {
+		t.Fatal("Could not disclose credential:", r2.Error)
+	}
+
+	verifiedCred, err := v.getSnapshot().domesticVerifier.VerifyQREncoded(r2.Value)
+	if err != nil {
+		t.Fatal("Could not verify proof:", err)
+	}
+
+	chunksJson, err := json.Marshal([]*RevocationChunk{
+		{Kid: verifiedCred.IssuerPkId, HashType: REVOCATION_HASH_TYPE_PROOF_IDENTIFIER, Id: "a", Hashes: []string{testRevocationHash(verifiedCred.ProofIdentifier)}},
+	})
+	if err != nil {
+		t.Fatal("Could not marshal revocation chunks", err)
+	}
+
+	revocationLists, err := NewRevocationListsFromJson(chunksJson)
+	if err != nil {
+		t.Fatal("Could not load revocation lists", err)
+	}
+
+	err = v.ReplaceRevocationLists(revocationLists)
+	if err != nil {
+		t.Fatal("Could not replace revocation lists", err)
+	}
+
+	r3 := v.Verify(r2.Value)
+	if r3.Failure == nil || r3.Failure.Reason != FAILURE_REASON_REVOKED {
+		t.Fatal("Expected the proof to be revoked")
+	}
+}
+
+func TestInvalidRevocationLists(t *testing.T) {
+	invalidChunksJsons := []string{
+		`{}`,
+		`[{"hashType": "UCI", "id": "a", "hashes": []}]`,
+		`[{"kid": "a", "hashType": "UNKNOWN", "id": "a", "hashes": []}]`,
+		`[{"kid": "a", "hashType": "UCI", "id": "a"}]`,
+		`[{"kid": "a", "hashType": "UCI", "id": "a", "hashes": ["dG9vIHNob3J0"]}]`,
+		`[{"kid": "a", "hashType": "UCI", "id": "a", "hashes": [], "bloomFilter": {"bits": "AA==", "hashCount": 1}}]`,
+		`[{"kid": "a", "hashType": "UCI", "id": "a", "bloomFilter": {"bits": "AA==", "hashCount": 0}}]`,
+	}
+
+	for i, invalidChunksJson := range invalidChunksJsons {
+		_, err := NewRevocationListsFromJson([]byte(invalidChunksJson))
+		if err == nil {
+			t.Fatal("Expected an error for invalid revocation chunks", i)
+		}
+	}
+
+	r1 := UpdateRevocationLists([]byte(`{`))
+	if r1.ErrorCode != ERROR_CODE_MALFORMED_INPUT {
+		t.Fatal("Expected a malformed input error, got", r1.ErrorCode)
+	}
+}
+
+func newRevocationTestVerifier(t *testing.T) *Verifier {
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	v, err := NewVerifier(configJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	return v
+}
+
+func testRevocationHash(value []byte) string {
+	hash := revocationHash(value)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// testBloomFilter builds a bloom filter of 256 bits and 3 hashes, containing the given hash
+func testBloomFilter(hash [REVOCATION_HASH_SIZE]byte) *RevocationBloomFilter {
+	bits := make([]byte, 32)
+	digest := sha256.Sum256(hash[:])
+	h1 := binary.BigEndian.Uint64(digest[0:8])
+	h2 := binary.BigEndian.Uint64(digest[8:16])
+
+	for i := 0; i < 3; i++ {
+		bitIndex := (h1 + uint64(i)*h2) % 256
+		bits[bitIndex/8] |= 1 << (bitIndex % 8)
+	}
+
+	return &RevocationBloomFilter{
+		Bits:      base64.StdEncoding.EncodeToString(bits),
+		HashCount: 3,
+	}
+}
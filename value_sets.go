@@ -0,0 +1,181 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	"sort"
+	"strings"
+)
+
+const VALUE_SETS_FILENAME = "value_sets.json"
+
+// The identifiers of the EU value sets that are used to validate the coded fields of a DCC
+const (
+	VALUE_SET_DISEASE_AGENT_TARGETED = "disease-agent-targeted"
+	VALUE_SET_VACCINE_PROPHYLAXIS    = "sct-vaccines-covid-19"
+	VALUE_SET_VACCINE_PRODUCT        = "vaccines-covid-19-names"
+	VALUE_SET_VACCINE_MANUFACTURER   = "vaccines-covid-19-auth-holders"
+	VALUE_SET_TEST_TYPE              = "covid-19-lab-test-type"
+	VALUE_SET_TEST_MANUFACTURER      = "covid-19-lab-test-manufacturer-and-name"
+	VALUE_SET_TEST_RESULT            = "covid-19-lab-result"
+	VALUE_SET_COUNTRY_CODES          = "country-2-codes"
+)
+
+// ValueSet is an EU value set, in the JSON format as published by the eHealth Network
+type ValueSet struct {
+	ValueSetId     string                    `json:"valueSetId"`
+	ValueSetDate   string                    `json:"valueSetDate"`
+	ValueSetValues map[string]*ValueSetValue `json:"valueSetValues"`
+}
+
+type ValueSetValue struct {
+	Display string `json:"display"`
+	Lang    string `json:"lang"`
+	Active  bool   `json:"active"`
+	Version string `json:"version"`
+	System  string `json:"system"`
+}
+
+// ValueSetsLookup maps the value set identifiers to the value sets. A code is only validated
+// against a value set if that value set is present, so that not every value set is required.
+type ValueSetsLookup map[string]*ValueSet
+
+// NewValueSetsFromJson loads a JSON list of value sets
+func NewValueSetsFromJson(valueSetsJson []byte) (ValueSetsLookup, error) {
+	var valueSets []*ValueSet
+	err := json.Unmarshal(valueSetsJson, &valueSets)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal value sets", 0)
+	}
+
+	lookup := ValueSetsLookup{}
+	for _, valueSet := range valueSets {
+		if valueSet == nil || valueSet.ValueSetId == "" || len(valueSet.ValueSetValues) == 0 {
+			return nil, errors.Errorf("Every value set should have an identifier and values")
+		}
+
+		if _, ok := lookup[valueSet.ValueSetId]; ok {
+			return nil, errors.Errorf("Value set %s is present more than once", valueSet.ValueSetId)
+		}
+
+		lookup[valueSet.ValueSetId] = valueSet
+	}
+
+	return lookup, nil
+}
+
+// Display translates a code into its display name, or returns the code itself when it is unknown
+func (vsl ValueSetsLookup) Display(valueSetId, code string) string {
+	value := vsl.findValue(valueSetId, code)
+	if value == nil || value.Display == "" {
+		return code
+	}
+
+	return value.Display
+}
+
+// validateCode checks that a code is present in the value set, if that value set is loaded.
+// Inactive codes are still accepted, as these may be present in certificates issued before.
+func (vsl ValueSetsLookup) validateCode(valueSetId, code string) error {
+	valueSet, ok := vsl[valueSetId]
+	if !ok {
+		return nil
+	}
+
+	if _, ok = valueSet.ValueSetValues[strings.TrimSpace(code)]; !ok {
+		return failuref(FAILURE_REASON_UNKNOWN_VALUE_SET_CODE, "Code '%s' is not part of value set %s", code, valueSetId)
+	}
+
+	return nil
+}
+
+func (vsl ValueSetsLookup) findValue(valueSetId, code string) *ValueSetValue {
+	valueSet, ok := vsl[valueSetId]
+	if !ok {
+		return nil
+	}
+
+	return valueSet.ValueSetValues[strings.TrimSpace(code)]
+}
+
+// certLogicValueSets returns the codes per value set, as used by the external parameters of CertLogic
+func (vsl ValueSetsLookup) certLogicValueSets() map[string][]string {
+	valueSets := map[string][]string{}
+	for valueSetId, valueSet := range vsl {
+		codes := make([]string, 0, len(valueSet.ValueSetValues))
+		for code := range valueSet.ValueSetValues {
+			codes = append(codes, code)
+		}
+
+		sort.Strings(codes)
+		valueSets[valueSetId] = codes
+	}
+
+	return valueSets
+}
+
+// validateDCCCodes checks the coded fields of all statements against the loaded value sets
+func validateDCCCodes(dcc *hcertcommon.DCC, valueSets ValueSetsLookup) error {
+	type codedField struct {
+		valueSetId string
+		code       string
+	}
+
+	var codedFields []codedField
+	for _, vacc := range dcc.Vaccinations {
+		codedFields = append(codedFields,
+			codedField{VALUE_SET_DISEASE_AGENT_TARGETED, vacc.DiseaseTargeted},
+			codedField{VALUE_SET_VACCINE_PROPHYLAXIS, vacc.Vaccine},
+			codedField{VALUE_SET_VACCINE_PRODUCT, vacc.MedicinalProduct},
+			codedField{VALUE_SET_VACCINE_MANUFACTURER, vacc.Manufacturer},
+			codedField{VALUE_SET_COUNTRY_CODES, vacc.CountryOfVaccination},
+		)
+	}
+
+	for _, test := range dcc.Tests {
+		codedFields = append(codedFields,
+			codedField{VALUE_SET_DISEASE_AGENT_TARGETED, test.DiseaseTargeted},
+			codedField{VALUE_SET_TEST_TYPE, test.TypeOfTest},
+			codedField{VALUE_SET_TEST_RESULT, test.TestResult},
+			codedField{VALUE_SET_COUNTRY_CODES, test.CountryOfVaccination},
+		)
+
+		// The manufacturer is only present for rapid antigen tests
+		if strings.TrimSpace(test.TestNameAndManufacturer) != "" {
+			codedFields = append(codedFields, codedField{VALUE_SET_TEST_MANUFACTURER, test.TestNameAndManufacturer})
+		}
+	}
+
+	for _, rec := range dcc.Recoveries {
+		codedFields = append(codedFields,
+			codedField{VALUE_SET_DISEASE_AGENT_TARGETED, rec.DiseaseTargeted},
+			codedField{VALUE_SET_COUNTRY_CODES, rec.CountryOfTest},
+		)
+	}
+
+	for _, field := range codedFields {
+		err := valueSets.validateCode(field.valueSetId, field.code)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetValueSetDisplay translates a code of a DCC into its display name, using the value sets
+// of the default holder. The value of the result is the display name, or the code itself.
+func GetValueSetDisplay(valueSetId, code string) *Result {
+	return defaultHolder.GetValueSetDisplay(valueSetId, code)
+}
+
+func (h *Holder) GetValueSetDisplay(valueSetId, code string) (result *Result) {
+	defer recoverResult(&result)
+
+	if h == nil {
+		return holderNotInitializedResult()
+	}
+
+	return &Result{[]byte(h.valueSets.Display(valueSetId, code)), "", ""}
+}
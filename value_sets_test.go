@@ -0,0 +1,197 @@
+package mobilecore
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testValueSetsJson = []byte(`[
+	{
+		"valueSetId": "vaccines-covid-19-names",
+		"valueSetDate": "2021-04-27",
+		"valueSetValues": {
+			"EU/1/20/1528": {"display": "Comirnaty", "lang": "en", "active": true, "version": "", "system": "https://ec.europa.eu/health/documents/community-register/html/"},
+			"EU/1/20/1507": {"display": "COVID-19 Vaccine Moderna", "lang": "en", "active": true, "version": "", "system": "https://ec.europa.eu/health/documents/community-register/html/"}
+		}
+	},
+	{
+		"valueSetId": "country-2-codes",
+		"valueSetDate": "2021-04-27",
+		"valueSetValues": {
+			"NL": {"display": "Netherlands", "lang": "en", "active": true, "version": "", "system": "urn:iso:std:iso:3166"}
+		}
+	}
+]`)
+
+func TestValueSets(t *testing.T) {
+	valueSets, err := NewValueSetsFromJson(testValueSetsJson)
+	if err != nil {
+		t.Fatal("Could not load value sets", err)
+	}
+
+	invalidValueSetsJsons := []string{
+		`{}`,
+		`[null]`,
+		`[{"valueSetId": "empty", "valueSetValues": {}}]`,
+		`[{"valueSetId": "a", "valueSetValues": {"b": {}}}, {"valueSetId": "a", "valueSetValues": {"c": {}}}]`,
+	}
+
+	for i, invalidValueSetsJson := range invalidValueSetsJsons {
+		_, err = NewValueSetsFromJson([]byte(invalidValueSetsJson))
+		if err == nil {
+			t.Fatal("Expected an error for invalid value sets", i)
+		}
+	}
+
+	// Display names
+	if valueSets.Display(VALUE_SET_VACCINE_PRODUCT, " EU/1/20/1528") != "Comirnaty" {
+		t.Fatal("Expected the display name of a known code")
+	}
+
+	if valueSets.Display(VALUE_SET_VACCINE_PRODUCT, "Sputnik-V") != "Sputnik-V" {
+		t.Fatal("Expected the code itself for an unknown code")
+	}
+
+	if ValueSetsLookup(nil).Display(VALUE_SET_COUNTRY_CODES, "NL") != "NL" {
+		t.Fatal("Expected the code itself without value sets")
+	}
+
+	// Only the loaded value sets are used for validation
+	err = validateDCCCodes(getHcert("VTR", nil).DCC, valueSets)
+	if err != nil {
+		t.Fatal("Expected the codes of the test DCC to be valid", err)
+	}
+
+	err = validateDCCCodes(getHcert("V", vaccChange("Sputnik-V", "MedicinalProduct")).DCC, valueSets)
+	if getVerificationFailure(err).Reason != FAILURE_REASON_UNKNOWN_VALUE_SET_CODE {
+		t.Fatal("Expected an unknown code failure for an unknown vaccine")
+	}
+
+	err = validateDCCCodes(getHcert("R", recChange("XX", "CountryOfTest")).DCC, valueSets)
+	if getVerificationFailure(err).Reason != FAILURE_REASON_UNKNOWN_VALUE_SET_CODE {
+		t.Fatal("Expected an unknown code failure for an unknown country")
+	}
+
+	// The codes are part of the CertLogic value sets
+	rules := defaultVerifier.getSnapshot().config.EuropeanVerificationRules
+	data, err := buildCertLogicData(getHcert("V", nil), rules, valueSets, DEFAULT_COUNTRY_OF_ARRIVAL, time.Now())
+	if err != nil {
+		t.Fatal("Could not build CertLogic data", err)
+	}
+
+	codes := evaluateCertLogicVar("external.valueSets.vaccines-covid-19-names", data).([]interface{})
+	if len(codes) != 2 || codes[0] != "EU/1/20/1507" {
+		t.Fatal("Expected the vaccine codes in the CertLogic value sets")
+	}
+}
+
+func TestVerifierValueSets(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	v, err := NewVerifier(configJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	// The default QR contains a vaccination with EU/1/20/1528
+	withoutComirnatyJson := []byte(strings.Replace(string(testValueSetsJson), `"EU/1/20/1528"`, `"EU/1/21/1529"`, 1))
+	withoutComirnaty, err := NewValueSetsFromJson(withoutComirnatyJson)
+	if err != nil {
+		t.Fatal("Could not load value sets", err)
+	}
+
+	err = v.UpdateValueSets(withoutComirnaty)
+	if err != nil {
+		t.Fatal("Could not update value sets", err)
+	}
+
+	r1 := v.verify(defaultQR, now)
+	if r1.Status != VERIFICATION_FAILED_ERROR || r1.Failure.Reason != FAILURE_REASON_UNKNOWN_VALUE_SET_CODE {
+		t.Fatal("Expected an unknown code failure, got", r1.Status, r1.Error)
+	}
+
+	// The value sets remain in use when the config is reloaded
+	err = v.Reload(configJson, pksConfig)
+	if err != nil {
+		t.Fatal("Could not reload verifier", err)
+	}
+
+	r2 := v.verify(defaultQR, now)
+	if r2.Status != VERIFICATION_FAILED_ERROR {
+		t.Fatal("Expected the value sets to remain in use after a reload")
+	}
+
+	valueSets, err := NewValueSetsFromJson(testValueSetsJson)
+	if err != nil {
+		t.Fatal("Could not load value sets", err)
+	}
+
+	err = v.UpdateValueSets(valueSets)
+	if err != nil {
+		t.Fatal("Could not update value sets", err)
+	}
+
+	r3 := v.verify(defaultQR, now)
+	if r3.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Expected the default QR to verify with the value sets", r3.Error)
+	}
+
+	// Value sets are read from the config directory
+	dir := t.TempDir()
+	for _, filename := range []string{VERIFIER_CONFIG_FILENAME, VERIFIER_PUBLIC_KEYS_FILENAME} {
+		fileJson, err := os.ReadFile(path.Join("./testdata", filename))
+		if err != nil {
+			t.Fatal("Could not read", filename, err)
+		}
+
+		err = os.WriteFile(path.Join(dir, filename), fileJson, 0600)
+		if err != nil {
+			t.Fatal("Could not write", filename, err)
+		}
+	}
+
+	err = os.WriteFile(path.Join(dir, VALUE_SETS_FILENAME), testValueSetsJson, 0600)
+	if err != nil {
+		t.Fatal("Could not write value sets", err)
+	}
+
+	r4 := InitializeHolder(dir)
+	if r4.Error != "" {
+		t.Fatal("Could not initialize holder", r4.Error)
+	}
+
+	r5 := GetValueSetDisplay(VALUE_SET_COUNTRY_CODES, "NL")
+	if r5.Error != "" || string(r5.Value) != "Netherlands" {
+		t.Fatal("Expected the display name of the country", r5.Error)
+	}
+
+	r6 := InitializeVerifier(dir, time.Now().Unix())
+	if r6.Error != "" {
+		t.Fatal("Could not initialize verifier", r6.Error)
+	}
+
+	if len(defaultVerifier.getSnapshot().valueSets) != 2 {
+		t.Fatal("Expected the value sets to be loaded by the default verifier")
+	}
+
+	r7 := UpdateValueSets([]byte(`{`))
+	if r7.ErrorCode != ERROR_CODE_INVALID_CONFIG {
+		t.Fatal("Expected invalid config error code for invalid value sets, got", r7.ErrorCode)
+	}
+
+	// Restore the default instances for the other tests
+	TestInitialization(t)
+}
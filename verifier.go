@@ -2,13 +2,13 @@ package mobilecore
 
 import (
 	"encoding/base64"
-	"encoding/json"
 	"github.com/go-errors/errors"
 	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
 	hcertverifier "github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
 	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
-	"os"
 	"path"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -22,16 +22,27 @@ const (
 	VERIFICATION_FAILED_UNRECOGNIZED_PREFIX
 	VERIFICATION_FAILED_IS_NL_DCC
 	VERIFICATION_FAILED_ERROR
+	VERIFICATION_FAILED_APP_DEACTIVATED
+	VERIFICATION_FAILED_CONFIG_EXPIRED
 )
 
 type VerificationResult struct {
 	Status  int
 	Details *VerificationDetails
 	Error   string
+
+	// The typed counterpart of the details, with a statement summary in extended mode
+	DetailsV2 *VerificationDetailsV2
+
+	// Only present when the status is VERIFICATION_FAILED_ERROR
+	Failure *VerificationFailure
+
+	// The version of the European rules of the country of arrival, for European QR codes
+	RulesVersion string
 }
 
 // VerificationDetails very much mimics the domestic verifier attributes, with only string type values,
-//  to minimize app-side changes. In the future, both should return properly typed values.
+//  to minimize app-side changes. VerificationDetailsV2 contains the same details with properly typed values.
 type VerificationDetails struct {
 	CredentialVersion string `json:"credentialVersion"`
 	IsSpecimen        string `json:"isSpecimen"`
@@ -41,119 +52,706 @@ type VerificationDetails struct {
 	LastNameInitial  string `json:"lastNameInitial"`
 	BirthDay         string `json:"birthDay"`
 	BirthMonth       string `json:"birthMonth"`
+
+	// The comma separated names of the attributes that the holder didn't disclose, if any
+	HiddenAttributes string `json:"hiddenAttributes"`
+
+	VerificationPolicy string `json:"verificationPolicy"`
 }
 
 type verifierConfiguration struct {
+	AppDeactivated bool `json:"appDeactivated"`
+
+	// The config is stale configTTL seconds after it has been fetched, and verification is refused
+	// after the grace period. A configTTL of zero disables the staleness policy.
+	ConfigTTL                int `json:"configTTL"`
+	ConfigGracePeriodSeconds int `json:"configGracePeriodSeconds"`
+
+	// The policies that can be chosen per scan, which only consist of the default 3G policy if absent
+	VerificationPolicies      []*verificationPolicy `json:"verificationPolicies"`
+	DefaultVerificationPolicy string                `json:"defaultVerificationPolicy"`
+
 	DomesticVerificationRules *domesticVerificationRules
 	EuropeanVerificationRules *europeanVerificationRules
+
+	// The rules of other countries of arrival or departure, by ISO 3166 alpha-2 country code.
+	// The European verification rules above are the rules of the Netherlands.
+	EuropeanCountryRules map[string]*europeanVerificationRules `json:"europeanCountryRules"`
 }
 
 type domesticVerificationRules struct {
 	QRValidForSeconds       int             `json:"qrValidForSeconds"`
 	ProofIdentifierDenylist map[string]bool `json:"proofIdentifierDenylist"`
+
+	// Paper proofs are static, so they may be restricted to a shorter validity and denied separately.
+	// A zero maximum validity leaves the validity of paper proofs as issued.
+	PaperProofMaxValidityHours   int             `json:"paperProofMaxValidityHours"`
+	PaperProofIdentifierDenylist map[string]bool `json:"paperProofIdentifierDenylist"`
 }
 
 type europeanVerificationRules struct {
+	RulesVersion string `json:"rulesVersion"`
+
 	TestAllowedTypes  []string `json:"testAllowedTypes"`
 	TestValidityHours int      `json:"testValidityHours"`
 
-	VaccinationValidityDelayDays               int      `json:"vaccinationValidityDelayDays"`
-	VaccinationJanssenValidityDelayDays        int      `json:"vaccinationJanssenValidityDelayDays"`
-	VaccinationJanssenValidityIntoForceDateStr string   `json:"vaccinationJanssenValidityDelayIntoForceDate"`
-	VaccineAllowedProducts                     []string `json:"vaccineAllowedProducts"`
+	// Rapid antigen tests are only accepted from the listed devices, if any devices are listed
+	TestAllowedRATDevices []*allowedTestDevice `json:"testAllowedRATDevices"`
+
+	VaccinationValidityDelayDays int      `json:"vaccinationValidityDelayDays"`
+	VaccineAllowedProducts       []string `json:"vaccineAllowedProducts"`
+
+	// The validity of a complete primary series, after which a booster is required. Zero means unlimited.
+	VaccinationValidityDays int `json:"vaccinationValidityDays"`
+
+	// Per product rules, that take precedence over the generic vaccination rules above
+	VaccinationProductRules []*vaccinationProductRule `json:"vaccinationProductRules"`
+
+	// DEPRECATED: Use a vaccination product rule for Janssen instead, which these fields are translated into
+	VaccinationJanssenValidityDelayDays        int    `json:"vaccinationJanssenValidityDelayDays"`
+	VaccinationJanssenValidityIntoForceDateStr string `json:"vaccinationJanssenValidityDelayIntoForceDate"`
 
 	RecoveryValidFromDays  int `json:"recoveryValidFromDays"`
 	RecoveryValidUntilDays int `json:"recoveryValidUntilDays"`
 
 	ProofIdentifierDenylist map[string]bool `json:"proofIdentifierDenylist"`
 
-	vaccinationJanssenValidityDelayIntoForceDate time.Time
+	// When business rules are configured, these replace the built-in rules for the statements
+	BusinessRules         []*BusinessRule     `json:"businessRules"`
+	BusinessRuleValueSets map[string][]string `json:"businessRuleValueSets"`
 }
 
-var (
-	verifierConfig *verifierConfiguration
+// vaccinationProductRule overrides the generic vaccination rules for a single medicinal product.
+// A dose number above the total series of doses, or above the primary series doses of the product
+// (such as 3/3 for a two dose vaccine), is a booster. Fields that are absent use the generic rules.
+type vaccinationProductRule struct {
+	MedicinalProduct string `json:"medicinalProduct"`
+
+	// The delay only applies to vaccinations on or after the into force date, if present
+	ValidityDelayDays             *int   `json:"validityDelayDays"`
+	ValidityDelayIntoForceDateStr string `json:"validityDelayIntoForceDate"`
+	ValidityDays                  *int   `json:"validityDays"`
+
+	PrimarySeriesDoses       int `json:"primarySeriesDoses"`
+	BoosterValidityDelayDays int `json:"boosterValidityDelayDays"`
+
+	validityDelayIntoForceDate time.Time
+}
+
+// allowedTestDevice is an entry of the EU common list of rapid antigen test devices. The optional
+// validity dates (inclusive) apply to the time at which the sample was collected.
+type allowedTestDevice struct {
+	Identifier    string `json:"id"`
+	ValidFromStr  string `json:"validFrom"`
+	ValidUntilStr string `json:"validUntil"`
+
+	validFrom  time.Time
+	validUntil time.Time
+}
+
+// countryRules are the European verification rules of a single country
+type countryRules struct {
+	countryCode string
+	rules       *europeanVerificationRules
+}
+
+// verificationOptions are the choices that can be made per scan. Empty values use the defaults
+// of the config, and the Netherlands as country of arrival.
+type verificationOptions struct {
+	policyId           string
+	countryOfArrival   string
+	countryOfDeparture string
+	extendedDetails    bool
+}
+
+// Verifier holds a verifier configuration together with the public keys it verifies against,
+// so that multiple independent verifier setups can be used within a single process.
+// It is safe for concurrent use, and its configuration can be reloaded while verifying.
+type Verifier struct {
+	snapshotLock sync.RWMutex
+	snapshot     *verifierSnapshot
+}
+
+// verifierSnapshot is an immutable combination of configuration and public keys,
+// so that a single verification always uses a consistent set of both
+type verifierSnapshot struct {
+	config           *verifierConfiguration
+	configFetchedAt  time.Time
+	publicKeysConfig *PublicKeysConfig
 
 	domesticVerifier *idemixverifier.Verifier
 	europeanVerifier *hcertverifier.Verifier
-)
+	europeanPks      hcertverifier.PksLookup
+
+	// The EU value sets are optional, and are updated independently of the config and public keys
+	valueSets ValueSetsLookup
+
+	// The revocation lists are optional as well, and are updated incrementally
+	revocationLists *RevocationLists
+}
+
+// The default verifier instance, as used by the mobile apps through InitializeVerifier and Verify
+var defaultVerifier = &Verifier{}
+
+// InitializeVerifier loads the config and public keys files of the default verifier. The config
+// was fetched at the given unix timestamp, as stored by the apps when writing the config file,
+// so that restarting the app doesn't make an old config fresh again.
+func InitializeVerifier(configDirectoryPath string, configFetchedAtUnix int64) *Result {
+	return initializeVerifier(configDirectoryPath, nil, time.Unix(configFetchedAtUnix, 0))
+}
+
+// InitializeVerifierWithSignedConfig expects the config and public keys files to be the signed
+// envelopes as served by the backend, which are only used if their signature chains to one
+// of the given PEM encoded signing certificates
+func InitializeVerifierWithSignedConfig(configDirectoryPath string, signingCertsPem []byte, configFetchedAtUnix int64) *Result {
+	if len(signingCertsPem) == 0 {
+		return ErrorResult(codedErrorf(ERROR_CODE_INVALID_SIGNATURE, "No signing certificates were provided"))
+	}
+
+	return initializeVerifier(configDirectoryPath, signingCertsPem, time.Unix(configFetchedAtUnix, 0))
+}
+
+func initializeVerifier(configDirectoryPath string, signingCertsPem []byte, configFetchedAt time.Time) (result *Result) {
+	defer recoverResult(&result)
 
-func InitializeVerifier(configDirectoryPath string) *Result {
 	configPath := path.Join(configDirectoryPath, VERIFIER_CONFIG_FILENAME)
 	pksPath := path.Join(configDirectoryPath, VERIFIER_PUBLIC_KEYS_FILENAME)
 
-	// Load config
-	configJson, err := os.ReadFile(configPath)
+	// Load config and public keys, verifying their signature if requested
+	configJson, pksJson, err := readConfigFiles(configPath, pksPath, signingCertsPem)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not read verifier config file")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not read verifier config files")
 	}
 
-	err = json.Unmarshal(configJson, &verifierConfig)
+	// Read public keys
+	publicKeysConfig, err := NewPublicKeysConfigFromJson(pksJson, true)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not load public keys config")
+	}
+
+	// Read the value sets, if present
+	valueSets, err := readValueSetsFile(path.Join(configDirectoryPath, VALUE_SETS_FILENAME), signingCertsPem)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not JSON unmarshal verifier config")
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not load value sets")
 	}
 
-	if verifierConfig.DomesticVerificationRules == nil {
-		return ErrorResult(errors.Errorf("The domestic verification rules were not present"))
+	// Read the revocation lists, if present
+	revocationLists, err := readRevocationListsFile(path.Join(configDirectoryPath, REVOCATION_LISTS_FILENAME), signingCertsPem)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not load revocation lists")
 	}
 
-	if verifierConfig.EuropeanVerificationRules == nil {
-		return ErrorResult(errors.Errorf("The European verification rules were not present"))
+	config, err := parseVerifierConfig(configJson)
+	if err != nil {
+		return ErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG))
 	}
 
-	// Parse date once (and leave at default value if parsing goes awry)
-	verifierConfig.EuropeanVerificationRules.vaccinationJanssenValidityDelayIntoForceDate, _ = time.Parse(
-		YYYYMMDD_FORMAT,
-		verifierConfig.EuropeanVerificationRules.VaccinationJanssenValidityIntoForceDateStr,
-	)
+	// (Re)load the default verifier at once, so that it is never partially initialized
+	snapshot := newVerifierSnapshot(config, configFetchedAt, publicKeysConfig, valueSets, revocationLists)
+	defaultVerifier.publishSnapshot(snapshot)
 
-	// Read public keys
-	publicKeysConfig, err := NewPublicKeysConfig(pksPath, true)
+	return &Result{nil, "", ""}
+}
+
+// NewVerifier creates a verifier from the JSON verifier configuration, which was fetched at
+// the given time, and the public keys config
+func NewVerifier(configJson []byte, publicKeysConfig *PublicKeysConfig, configFetchedAt time.Time) (*Verifier, error) {
+	config, err := parseVerifierSetup(configJson, publicKeysConfig)
 	if err != nil {
-		return WrappedErrorResult(err, "Could not load public keys config")
+		return nil, err
 	}
 
-	// Initialize verifiers
-	domesticVerifier = idemixverifier.New(publicKeysConfig.FindAndCacheDomestic)
-	europeanVerifier = hcertverifier.New(publicKeysConfig.EuropeanPks)
+	v := &Verifier{}
+	v.publishSnapshot(newVerifierSnapshot(config, configFetchedAt, publicKeysConfig, nil, nil))
 
-	return &Result{nil, ""}
+	return v, nil
 }
 
-func Verify(proofQREncoded []byte) *VerificationResult {
-	return verify(proofQREncoded, time.Now())
+// Reload atomically replaces the configuration and public keys of an initialized verifier.
+// Verifications that are in progress will finish using the previous configuration.
+// The config fetch time, value sets and revocation lists remain as they were, as these are
+// only replaced separately.
+func (v *Verifier) Reload(configJson []byte, publicKeysConfig *PublicKeysConfig) error {
+	if v == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "Cannot reload a nil verifier")
+	}
+
+	config, err := parseVerifierSetup(configJson, publicKeysConfig)
+	if err != nil {
+		return err
+	}
+
+	return v.updateSnapshot(func(current *verifierSnapshot) *verifierSnapshot {
+		return newVerifierSnapshot(config, current.configFetchedAt, publicKeysConfig, current.valueSets, current.revocationLists)
+	})
 }
 
-func verify(proofQREncoded []byte, now time.Time) *VerificationResult {
-	if idemixverifier.HasNLPrefix(proofQREncoded) {
-		return handleDomesticVerification(proofQREncoded, now)
-	} else {
-		return handleEuropeanVerification(proofQREncoded, now)
+// parseVerifierSetup parses the config, and checks that the public keys config can be used with it
+func parseVerifierSetup(configJson []byte, publicKeysConfig *PublicKeysConfig) (*verifierConfiguration, error) {
+	if publicKeysConfig == nil {
+		return nil, errors.Errorf("No public keys config was provided")
+	}
+
+	config, err := parseVerifierConfig(configJson)
+	if err != nil {
+		return nil, err
+	}
+
+	if publicKeysConfig.EuropeanPks == nil {
+		return nil, errors.Errorf("No european keys map was present")
+	}
+
+	return config, nil
+}
+
+// UpdateConfig replaces only the configuration of an initialized verifier, so that the
+// public keys that were already loaded remain in use. The config fetch time is left as is,
+// and should be set with SetConfigFetchedAt when the config has been fetched anew.
+func (v *Verifier) UpdateConfig(configJson []byte) error {
+	if v == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "Cannot update the config of a nil verifier")
+	}
+
+	config, err := parseVerifierConfig(configJson)
+	if err != nil {
+		return err
 	}
+
+	return v.updateSnapshot(func(current *verifierSnapshot) *verifierSnapshot {
+		return &verifierSnapshot{
+			config:           config,
+			configFetchedAt:  current.configFetchedAt,
+			publicKeysConfig: current.publicKeysConfig,
+			domesticVerifier: current.domesticVerifier,
+			europeanVerifier: current.europeanVerifier,
+			europeanPks:      current.europeanPks,
+			valueSets:        current.valueSets,
+			revocationLists:  current.revocationLists,
+		}
+	})
 }
 
-func handleDomesticVerification(proofQREncoded []byte, now time.Time) *VerificationResult {
-	verificationDetails, err := verifyDomestic(proofQREncoded, verifierConfig.DomesticVerificationRules, now)
+// UpdatePublicKeys replaces only the public keys of an initialized verifier. Domestic public
+// keys that didn't change are taken over already loaded, so they don't have to be parsed again.
+func (v *Verifier) UpdatePublicKeys(publicKeysConfig *PublicKeysConfig) error {
+	if v == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "Cannot update the public keys of a nil verifier")
+	}
+
+	if publicKeysConfig == nil {
+		return errors.Errorf("No public keys config was provided")
+	}
+
+	if publicKeysConfig.EuropeanPks == nil {
+		return errors.Errorf("No european keys map was present")
+	}
+
+	return v.updateSnapshot(func(current *verifierSnapshot) *verifierSnapshot {
+		publicKeysConfig.takeOverLoadedDomesticPks(current.publicKeysConfig)
+
+		return newVerifierSnapshot(current.config, current.configFetchedAt, publicKeysConfig, current.valueSets, current.revocationLists)
+	})
+}
+
+// UpdateValueSets replaces the EU value sets of an initialized verifier. Without value sets,
+// the coded fields of a DCC are not validated against them.
+func (v *Verifier) UpdateValueSets(valueSets ValueSetsLookup) error {
+	if v == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "Cannot update the value sets of a nil verifier")
+	}
+
+	return v.updateSnapshot(func(current *verifierSnapshot) *verifierSnapshot {
+		updated := *current
+		updated.valueSets = valueSets
+
+		return &updated
+	})
+}
+
+// ReplaceRevocationLists replaces all revocation lists of an initialized verifier. Without
+// revocation lists, only the denylists of the config are checked.
+func (v *Verifier) ReplaceRevocationLists(revocationLists *RevocationLists) error {
+	if v == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "Cannot replace the revocation lists of a nil verifier")
+	}
+
+	return v.updateSnapshot(func(current *verifierSnapshot) *verifierSnapshot {
+		updated := *current
+		updated.revocationLists = revocationLists
+
+		return &updated
+	})
+}
+
+// UpdateRevocationLists applies the given revocation chunks to the revocation lists of an
+// initialized verifier, leaving the other chunks as they were
+func (v *Verifier) UpdateRevocationLists(chunks []*RevocationChunk) error {
+	if v == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "Cannot update the revocation lists of a nil verifier")
+	}
+
+	var updateErr error
+	err := v.updateSnapshot(func(current *verifierSnapshot) *verifierSnapshot {
+		revocationLists, err := current.revocationLists.update(chunks)
+		if err != nil {
+			updateErr = err
+			return current
+		}
+
+		updated := *current
+		updated.revocationLists = revocationLists
+
+		return &updated
+	})
+
 	if err != nil {
+		return err
+	}
+
+	return updateErr
+}
+
+func newVerifierSnapshot(config *verifierConfiguration, configFetchedAt time.Time, publicKeysConfig *PublicKeysConfig, valueSets ValueSetsLookup, revocationLists *RevocationLists) *verifierSnapshot {
+	return &verifierSnapshot{
+		config:           config,
+		configFetchedAt:  configFetchedAt,
+		publicKeysConfig: publicKeysConfig,
+		domesticVerifier: idemixverifier.New(publicKeysConfig.FindAndCacheDomestic),
+		europeanVerifier: hcertverifier.New(publicKeysConfig.EuropeanPks),
+		europeanPks:      publicKeysConfig.EuropeanPks,
+		valueSets:        valueSets,
+		revocationLists:  revocationLists,
+	}
+}
+
+func (v *Verifier) getSnapshot() *verifierSnapshot {
+	v.snapshotLock.RLock()
+	defer v.snapshotLock.RUnlock()
+
+	return v.snapshot
+}
+
+// publishSnapshot replaces the snapshot as a whole, regardless of whether there was one before
+func (v *Verifier) publishSnapshot(snapshot *verifierSnapshot) {
+	v.snapshotLock.Lock()
+	defer v.snapshotLock.Unlock()
+
+	v.snapshot = snapshot
+}
+
+// updateSnapshot derives a new snapshot from the current one while holding the lock,
+// so that concurrent partial updates cannot undo each other
+func (v *Verifier) updateSnapshot(update func(current *verifierSnapshot) *verifierSnapshot) error {
+	v.snapshotLock.Lock()
+	defer v.snapshotLock.Unlock()
+
+	if v.snapshot == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "The verifier has not been initialized")
+	}
+
+	v.snapshot = update(v.snapshot)
+
+	return nil
+}
+
+func parseVerifierConfig(configJson []byte) (*verifierConfiguration, error) {
+	config, err := unmarshalVerifierConfig(configJson)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse the config if there is any issue with it
+	issues := validateVerifierConfig(config)
+	if len(issues) != 0 {
+		return nil, configIssuesError(issues)
+	}
+
+	if len(config.VerificationPolicies) == 0 {
+		config.VerificationPolicies = defaultVerificationPolicies
+	}
+
+	if config.DefaultVerificationPolicy == "" {
+		config.DefaultVerificationPolicy = DEFAULT_VERIFICATION_POLICY
+	}
+
+	prepareEuropeanVerificationRules(config.EuropeanVerificationRules)
+	for _, countryRules := range config.EuropeanCountryRules {
+		prepareEuropeanVerificationRules(countryRules)
+	}
+
+	return config, nil
+}
+
+func prepareEuropeanVerificationRules(rules *europeanVerificationRules) {
+	translateJanssenValidityDelay(rules)
+
+	// Parse dates once, which are known to be either valid or empty
+	for _, productRule := range rules.VaccinationProductRules {
+		productRule.validityDelayIntoForceDate, _ = time.Parse(YYYYMMDD_FORMAT, productRule.ValidityDelayIntoForceDateStr)
+	}
+
+	for _, device := range rules.TestAllowedRATDevices {
+		device.validFrom, _ = time.Parse(YYYYMMDD_FORMAT, device.ValidFromStr)
+		device.validUntil, _ = time.Parse(YYYYMMDD_FORMAT, device.ValidUntilStr)
+	}
+}
+
+// findEuropeanRules returns the rules of the given country of arrival or departure, normalizing
+// its country code. An empty country code means the Netherlands, of which the rules are the default.
+func (config *verifierConfiguration) findEuropeanRules(countryCode string) (*countryRules, error) {
+	countryCode = strings.ToUpper(strings.TrimSpace(countryCode))
+	if countryCode == "" || countryCode == DEFAULT_COUNTRY_OF_ARRIVAL {
+		return &countryRules{DEFAULT_COUNTRY_OF_ARRIVAL, config.EuropeanVerificationRules}, nil
+	}
+
+	rules, ok := config.EuropeanCountryRules[countryCode]
+	if !ok {
+		return nil, failuref(FAILURE_REASON_UNKNOWN_COUNTRY, "No European verification rules are configured for country '%s'", countryCode)
+	}
+
+	return &countryRules{countryCode, rules}, nil
+}
+
+// DEPRECATED: Remove this translation together with the Janssen specific config fields
+func translateJanssenValidityDelay(rules *europeanVerificationRules) {
+	if rules.VaccinationJanssenValidityDelayDays == 0 && rules.VaccinationJanssenValidityIntoForceDateStr == "" {
+		return
+	}
+
+	if rules.findVaccinationProductRule(VACCINE_MEDICINAL_PRODUCT_JANSSEN) != nil {
+		return
+	}
+
+	validityDelayDays := rules.VaccinationJanssenValidityDelayDays
+	rules.VaccinationProductRules = append(rules.VaccinationProductRules, &vaccinationProductRule{
+		MedicinalProduct:              VACCINE_MEDICINAL_PRODUCT_JANSSEN,
+		ValidityDelayDays:             &validityDelayDays,
+		ValidityDelayIntoForceDateStr: rules.VaccinationJanssenValidityIntoForceDateStr,
+	})
+}
+
+func (rules *europeanVerificationRules) findVaccinationProductRule(medicinalProduct string) *vaccinationProductRule {
+	trimmedProduct := strings.TrimSpace(medicinalProduct)
+	for _, productRule := range rules.VaccinationProductRules {
+		if productRule.MedicinalProduct == trimmedProduct {
+			return productRule
+		}
+	}
+
+	return nil
+}
+
+// UpdateVerifierConfig applies a (freshly downloaded) verifier config to the initialized
+// default verifier, without re-reading the public keys, after which SetVerifierConfigFetchedAt should be
+// called with the time at which it was downloaded
+func UpdateVerifierConfig(configJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	err := defaultVerifier.UpdateConfig(configJson)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not update verifier config")
+	}
+
+	return &Result{nil, "", ""}
+}
+
+// UpdatePublicKeys applies (freshly downloaded) public keys to the initialized default verifier,
+// keeping the config and the domestic public keys that were already loaded
+func UpdatePublicKeys(pksJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	publicKeysConfig, err := NewPublicKeysConfigFromJson(pksJson, true)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not load public keys config")
+	}
+
+	err = defaultVerifier.UpdatePublicKeys(publicKeysConfig)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not update public keys")
+	}
+
+	return &Result{nil, "", ""}
+}
+
+// UpdateValueSets applies (freshly downloaded) EU value sets to the initialized default verifier
+func UpdateValueSets(valueSetsJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	valueSets, err := NewValueSetsFromJson(valueSetsJson)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not load value sets")
+	}
+
+	err = defaultVerifier.UpdateValueSets(valueSets)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not update value sets")
+	}
+
+	return &Result{nil, "", ""}
+}
+
+// UpdateRevocationLists applies (freshly downloaded) revocation chunks to the revocation lists
+// of the initialized default verifier, which only replaces or removes the given chunks
+func UpdateRevocationLists(revocationChunksJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	chunks, err := unmarshalRevocationChunks(revocationChunksJson)
+	if err != nil {
+		return ErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT))
+	}
+
+	err = defaultVerifier.UpdateRevocationLists(chunks)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG), "Could not update revocation lists")
+	}
+
+	return &Result{nil, "", ""}
+}
+
+func Verify(proofQREncoded []byte) *VerificationResult {
+	return defaultVerifier.Verify(proofQREncoded)
+}
+
+// VerifyWithPolicy only accepts the kinds of proof that are accepted by the given verification
+// policy of the config. An empty policy is the default policy, as used by Verify.
+func VerifyWithPolicy(proofQREncoded []byte, policy string) *VerificationResult {
+	return defaultVerifier.VerifyWithPolicy(proofQREncoded, policy)
+}
+
+// VerifyForCountry validates European QR codes against the rules of the given country of arrival,
+// and against the rules of the country of departure if that is not empty. Domestic QR codes are
+// only valid when the country of arrival is the Netherlands, which is also the default.
+func VerifyForCountry(proofQREncoded []byte, policy, countryOfArrival, countryOfDeparture string) *VerificationResult {
+	return defaultVerifier.VerifyForCountry(proofQREncoded, policy, countryOfArrival, countryOfDeparture)
+}
+
+// VerifyExtended is VerifyForCountry with a summary of the statement in the typed details, which
+// includes the validity window that is computed by the rules of the country of arrival
+func VerifyExtended(proofQREncoded []byte, policy, countryOfArrival, countryOfDeparture string) *VerificationResult {
+	return defaultVerifier.VerifyExtended(proofQREncoded, policy, countryOfArrival, countryOfDeparture)
+}
+
+func (v *Verifier) Verify(proofQREncoded []byte) (result *VerificationResult) {
+	defer recoverVerificationResult(&result)
+
+	return v.verify(proofQREncoded, time.Now())
+}
+
+func (v *Verifier) VerifyWithPolicy(proofQREncoded []byte, policy string) (result *VerificationResult) {
+	defer recoverVerificationResult(&result)
+
+	return v.verifyWithOptions(proofQREncoded, &verificationOptions{policyId: policy}, time.Now())
+}
+
+func (v *Verifier) VerifyForCountry(proofQREncoded []byte, policy, countryOfArrival, countryOfDeparture string) (result *VerificationResult) {
+	defer recoverVerificationResult(&result)
+
+	options := &verificationOptions{
+		policyId:           policy,
+		countryOfArrival:   countryOfArrival,
+		countryOfDeparture: countryOfDeparture,
+	}
+
+	return v.verifyWithOptions(proofQREncoded, options, time.Now())
+}
+
+func (v *Verifier) VerifyExtended(proofQREncoded []byte, policy, countryOfArrival, countryOfDeparture string) (result *VerificationResult) {
+	defer recoverVerificationResult(&result)
+
+	options := &verificationOptions{
+		policyId:           policy,
+		countryOfArrival:   countryOfArrival,
+		countryOfDeparture: countryOfDeparture,
+		extendedDetails:    true,
+	}
+
+	return v.verifyWithOptions(proofQREncoded, options, time.Now())
+}
+
+func (v *Verifier) verify(proofQREncoded []byte, now time.Time) *VerificationResult {
+	return v.verifyWithOptions(proofQREncoded, &verificationOptions{}, now)
+}
+
+func (v *Verifier) verifyWithOptions(proofQREncoded []byte, options *verificationOptions, now time.Time) *VerificationResult {
+	var snapshot *verifierSnapshot
+	if v != nil {
+		snapshot = v.getSnapshot()
+	}
+
+	if snapshot == nil {
 		return &VerificationResult{
-			Status: VERIFICATION_FAILED_ERROR,
-			Error:  errors.WrapPrefix(err, "Could not verify domestic QR code", 0).Error(),
+			Status:  VERIFICATION_FAILED_ERROR,
+			Error:   "The verifier has not been initialized",
+			Failure: &VerificationFailure{Reason: FAILURE_REASON_NOT_INITIALIZED},
 		}
 	}
 
-	return &VerificationResult{
-		Status:  VERIFICATION_SUCCESS,
-		Details: verificationDetails,
+	return snapshot.verify(proofQREncoded, options, now)
+}
+
+func (vs *verifierSnapshot) verify(proofQREncoded []byte, options *verificationOptions, now time.Time) *VerificationResult {
+	// Enforce the config policy before looking at the QR code
+	if vs.config.AppDeactivated {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_APP_DEACTIVATED,
+			Error:  "The app has been deactivated",
+		}
+	}
+
+	if vs.configStatus(now).IsExpired {
+		return &VerificationResult{
+			Status: VERIFICATION_FAILED_CONFIG_EXPIRED,
+			Error:  "The config is older than allowed, and should be fetched again",
+		}
+	}
+
+	policy, err := vs.config.findVerificationPolicy(options.policyId)
+	if err != nil {
+		return verificationErrorResult(err)
+	}
+
+	arrival, err := vs.config.findEuropeanRules(options.countryOfArrival)
+	if err != nil {
+		return verificationErrorResult(errors.WrapPrefix(err, "Unknown country of arrival", 0))
+	}
+
+	var departure *countryRules
+	if options.countryOfDeparture != "" {
+		departure, err = vs.config.findEuropeanRules(options.countryOfDeparture)
+		if err != nil {
+			return verificationErrorResult(errors.WrapPrefix(err, "Unknown country of departure", 0))
+		}
+	}
+
+	if idemixverifier.HasNLPrefix(proofQREncoded) {
+		// Domestic credentials only have meaning within the Netherlands
+		if arrival.countryCode != DEFAULT_COUNTRY_OF_ARRIVAL {
+			return verificationErrorResult(failuref(FAILURE_REASON_NOT_VALID_IN_COUNTRY, "Domestic QR codes are not valid in country %s", arrival.countryCode))
+		}
+
+		return vs.handleDomesticVerification(proofQREncoded, policy, options.extendedDetails, now)
+	} else {
+		return vs.handleEuropeanVerification(proofQREncoded, arrival, departure, policy, options.extendedDetails, now)
+	}
+}
+
+func (vs *verifierSnapshot) handleDomesticVerification(proofQREncoded []byte, policy *verificationPolicy, extendedDetails bool, now time.Time) *VerificationResult {
+	verificationDetails, statement, err := vs.verifyDomestic(proofQREncoded, vs.config.DomesticVerificationRules, policy, now)
+	if err != nil {
+		return verificationErrorResult(errors.WrapPrefix(err, "Could not verify domestic QR code", 0))
 	}
+
+	return successResult(verificationDetails, statement, extendedDetails)
 }
 
-func handleEuropeanVerification(proofQREncoded []byte, now time.Time) *VerificationResult {
+func (vs *verifierSnapshot) handleEuropeanVerification(proofQREncoded []byte, arrival, departure *countryRules, policy *verificationPolicy, extendedDetails bool, now time.Time) *VerificationResult {
 	// As some QR-codes by T-Systems apps miss the required prefix, add the prefix here if it isn't present
 	wasEUPrefixed := hcertcommon.HasEUPrefix(proofQREncoded)
 	if !wasEUPrefixed {
 		proofQREncoded = append([]byte{'H', 'C', '1', ':'}, proofQREncoded...)
 	}
 
-	verificationDetails, isNLDCC, err := verifyEuropean(proofQREncoded, verifierConfig.EuropeanVerificationRules, now)
+	verificationDetails, statement, isNLDCC, err := vs.verifyEuropean(proofQREncoded, arrival, departure, policy, now)
 	if err != nil {
 		// If the QR-code wasn't prefixed and it didn't verify, assume that it wasn't a EU QR code
 		if !wasEUPrefixed {
@@ -162,10 +760,10 @@ func handleEuropeanVerification(proofQREncoded []byte, now time.Time) *Verificat
 			}
 		}
 
-		return &VerificationResult{
-			Status: VERIFICATION_FAILED_ERROR,
-			Error:  errors.WrapPrefix(err, "Could not verify european QR code", 0).Error(),
-		}
+		result := verificationErrorResult(errors.WrapPrefix(err, "Could not verify european QR code", 0))
+		result.RulesVersion = arrival.rules.RulesVersion
+
+		return result
 	}
 
 	if isNLDCC {
@@ -174,9 +772,30 @@ func handleEuropeanVerification(proofQREncoded []byte, now time.Time) *Verificat
 		}
 	}
 
+	result := successResult(verificationDetails, statement, extendedDetails)
+	result.RulesVersion = arrival.rules.RulesVersion
+
+	return result
+}
+
+func successResult(details *VerificationDetails, statement *StatementDetails, extendedDetails bool) *VerificationResult {
+	detailsV2 := newVerificationDetailsV2(details)
+	if extendedDetails {
+		detailsV2.Statement = statement
+	}
+
+	return &VerificationResult{
+		Status:    VERIFICATION_SUCCESS,
+		Details:   details,
+		DetailsV2: detailsV2,
+	}
+}
+
+func verificationErrorResult(err error) *VerificationResult {
 	return &VerificationResult{
-		Status:  VERIFICATION_SUCCESS,
-		Details: verificationDetails,
+		Status:  VERIFICATION_FAILED_ERROR,
+		Error:   err.Error(),
+		Failure: getVerificationFailure(err),
 	}
 }
 
@@ -185,12 +804,17 @@ func checkDenylist(proofIdentifier []byte, denyList map[string]bool) error {
 
 	denied, ok := denyList[proofIdentifierBase64]
 	if ok && denied {
-		return errors.Errorf("The credential identifier was present in the proof identifier denylist")
+		return failuref(FAILURE_REASON_DENYLISTED, "The credential identifier was present in the proof identifier denylist")
 	}
 
 	return nil
 }
 
-func GetVerifiersForCLI() (*idemixverifier.Verifier, *hcertverifier.Verifier) {
-	return domesticVerifier, europeanVerifier
+func GetVerifiersForCLI() (*idemixverifier.Verifier, *hcertverifier.Verifier, error) {
+	snapshot := defaultVerifier.getSnapshot()
+	if snapshot == nil {
+		return nil, nil, errors.Errorf("The verifier has not been initialized")
+	}
+
+	return snapshot.domesticVerifier, snapshot.europeanVerifier, nil
 }
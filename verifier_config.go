@@ -0,0 +1,401 @@
+package mobilecore
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var COUNTRY_CODE_REGEX = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ConfigIssue describes a single problem in a configuration, by the JSON path of the field
+// that has the problem and a human readable message
+type ConfigIssue struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// configIssues collects the issues of a configuration, so that all of them are reported at once
+type configIssues []*ConfigIssue
+
+func (issues *configIssues) add(field string, format string, a ...interface{}) {
+	*issues = append(*issues, &ConfigIssue{
+		Field:   field,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// VerifierConfigStatus describes the freshness of the verifier config, with unix timestamps
+type VerifierConfigStatus struct {
+	FetchedAt      int64 `json:"fetchedAt"`
+	StaleAt        int64 `json:"staleAt"`
+	ExpiresAt      int64 `json:"expiresAt"`
+	IsStale        bool  `json:"isStale"`
+	IsExpired      bool  `json:"isExpired"`
+	AppDeactivated bool  `json:"appDeactivated"`
+}
+
+// GetVerifierConfigStatus reports whether the config of the default verifier is stale (and
+// should be fetched again), or expired (so that verification is refused)
+func GetVerifierConfigStatus() (result *Result) {
+	defer recoverResult(&result)
+
+	status, err := defaultVerifier.ConfigStatus()
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	statusJson, err := json.Marshal(status)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal config status")
+	}
+
+	return &Result{statusJson, "", ""}
+}
+
+// SetVerifierConfigFetchedAt tells the default verifier when its config was fetched, which is
+// the only way to change the fetch time after initialization, such as after updating the config
+func SetVerifierConfigFetchedAt(fetchedAtUnix int64) (result *Result) {
+	defer recoverResult(&result)
+
+	err := defaultVerifier.SetConfigFetchedAt(time.Unix(fetchedAtUnix, 0))
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	return &Result{nil, "", ""}
+}
+
+func (v *Verifier) SetConfigFetchedAt(fetchedAt time.Time) error {
+	if v == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "Cannot set the config fetch time of a nil verifier")
+	}
+
+	return v.updateSnapshot(func(current *verifierSnapshot) *verifierSnapshot {
+		updated := *current
+		updated.configFetchedAt = fetchedAt
+
+		return &updated
+	})
+}
+
+func (v *Verifier) ConfigStatus() (*VerifierConfigStatus, error) {
+	var snapshot *verifierSnapshot
+	if v != nil {
+		snapshot = v.getSnapshot()
+	}
+
+	if snapshot == nil {
+		return nil, codedErrorf(ERROR_CODE_NOT_INITIALIZED, "The verifier has not been initialized")
+	}
+
+	return snapshot.configStatus(time.Now()), nil
+}
+
+func (vs *verifierSnapshot) configStatus(now time.Time) *VerifierConfigStatus {
+	status := &VerifierConfigStatus{
+		FetchedAt:      vs.configFetchedAt.Unix(),
+		AppDeactivated: vs.config.AppDeactivated,
+	}
+
+	if vs.config.ConfigTTL == 0 {
+		return status
+	}
+
+	staleAt := vs.configFetchedAt.Add(time.Duration(vs.config.ConfigTTL) * time.Second)
+	expiresAt := staleAt.Add(time.Duration(vs.config.ConfigGracePeriodSeconds) * time.Second)
+
+	status.StaleAt = staleAt.Unix()
+	status.ExpiresAt = expiresAt.Unix()
+	status.IsStale = now.After(staleAt)
+	status.IsExpired = now.After(expiresAt)
+
+	return status
+}
+
+// ValidateVerifierConfig reports all problems of the given verifier configuration at once.
+// The value of the result is a JSON list of issues, which is empty for a valid configuration.
+func ValidateVerifierConfig(configJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	config, err := unmarshalVerifierConfig(configJson)
+	if err != nil {
+		return ErrorResult(withErrorCode(err, ERROR_CODE_INVALID_CONFIG))
+	}
+
+	issues := validateVerifierConfig(config)
+
+	issuesJson, err := json.Marshal(issues)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal config issues")
+	}
+
+	return &Result{issuesJson, "", ""}
+}
+
+func unmarshalVerifierConfig(configJson []byte) (*verifierConfiguration, error) {
+	var config *verifierConfiguration
+	err := json.Unmarshal(configJson, &config)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal verifier config", 0)
+	}
+
+	if config == nil {
+		return nil, errors.Errorf("The verifier config was empty")
+	}
+
+	return config, nil
+}
+
+// parseEuropeanVerificationRules parses a single set of European verification rules, as present
+// in the verifier config, and refuses the rules if there is any issue with them
+func parseEuropeanVerificationRules(rulesJson []byte) (*europeanVerificationRules, error) {
+	var rules *europeanVerificationRules
+	err := json.Unmarshal(rulesJson, &rules)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal European verification rules", 0)
+	}
+
+	if rules == nil {
+		return nil, errors.Errorf("The European verification rules were empty")
+	}
+
+	issues := configIssues{}
+	validateEuropeanVerificationRules("europeanVerificationRules", rules, issues.add)
+	if len(issues) != 0 {
+		return nil, configIssuesError(issues)
+	}
+
+	prepareEuropeanVerificationRules(rules)
+
+	return rules, nil
+}
+
+func validateVerifierConfig(config *verifierConfiguration) configIssues {
+	issues := configIssues{}
+	addIssue := issues.add
+
+	if config.ConfigTTL < 0 {
+		addIssue("configTTL", "Should not be negative, but is %d", config.ConfigTTL)
+	}
+
+	if config.ConfigGracePeriodSeconds < 0 {
+		addIssue("configGracePeriodSeconds", "Should not be negative, but is %d", config.ConfigGracePeriodSeconds)
+	}
+
+	validateVerificationPolicies(config, addIssue)
+
+	if config.DomesticVerificationRules == nil {
+		addIssue("domesticVerificationRules", "The domestic verification rules were not present")
+	} else {
+		validateDomesticVerificationRules("domesticVerificationRules", config.DomesticVerificationRules, addIssue)
+	}
+
+	if config.EuropeanVerificationRules == nil {
+		addIssue("europeanVerificationRules", "The European verification rules were not present")
+	} else {
+		validateEuropeanVerificationRules("europeanVerificationRules", config.EuropeanVerificationRules, addIssue)
+	}
+
+	// Sort the country codes, so that the issues are reported in a stable order
+	countryCodes := make([]string, 0, len(config.EuropeanCountryRules))
+	for countryCode := range config.EuropeanCountryRules {
+		countryCodes = append(countryCodes, countryCode)
+	}
+
+	sort.Strings(countryCodes)
+
+	for _, countryCode := range countryCodes {
+		field := "europeanCountryRules." + countryCode
+		if !COUNTRY_CODE_REGEX.MatchString(countryCode) {
+			addIssue(field, "Should be keyed by an uppercase ISO 3166 alpha-2 country code")
+		}
+
+		if countryCode == DEFAULT_COUNTRY_OF_ARRIVAL {
+			addIssue(field, "The rules of %s are the European verification rules, and should not be repeated", countryCode)
+		}
+
+		countryRules := config.EuropeanCountryRules[countryCode]
+		if countryRules == nil {
+			addIssue(field, "The European verification rules were not present")
+			continue
+		}
+
+		validateEuropeanVerificationRules(field, countryRules, addIssue)
+	}
+
+	return issues
+}
+
+func validateDomesticVerificationRules(field string, rules *domesticVerificationRules, addIssue func(field string, format string, a ...interface{})) {
+	if rules.QRValidForSeconds <= 0 {
+		addIssue(field+".qrValidForSeconds", "Should be positive, but is %d", rules.QRValidForSeconds)
+	}
+
+	validateDenylist(field+".proofIdentifierDenylist", rules.ProofIdentifierDenylist, addIssue)
+
+	if rules.PaperProofMaxValidityHours < 0 {
+		addIssue(field+".paperProofMaxValidityHours", "Should not be negative, but is %d", rules.PaperProofMaxValidityHours)
+	}
+
+	validateDenylist(field+".paperProofIdentifierDenylist", rules.PaperProofIdentifierDenylist, addIssue)
+}
+
+func validateEuropeanVerificationRules(field string, rules *europeanVerificationRules, addIssue func(field string, format string, a ...interface{})) {
+	if len(rules.TestAllowedTypes) == 0 {
+		addIssue(field+".testAllowedTypes", "Should not be empty")
+	}
+
+	if rules.TestValidityHours <= 0 {
+		addIssue(field+".testValidityHours", "Should be positive, but is %d", rules.TestValidityHours)
+	}
+
+	validateAllowedTestDevices(field+".testAllowedRATDevices", rules.TestAllowedRATDevices, addIssue)
+
+	if rules.VaccinationValidityDelayDays < 0 {
+		addIssue(field+".vaccinationValidityDelayDays", "Should not be negative, but is %d", rules.VaccinationValidityDelayDays)
+	}
+
+	if rules.VaccinationJanssenValidityDelayDays < 0 {
+		addIssue(field+".vaccinationJanssenValidityDelayDays", "Should not be negative, but is %d", rules.VaccinationJanssenValidityDelayDays)
+	}
+
+	if rules.VaccinationValidityDays < 0 {
+		addIssue(field+".vaccinationValidityDays", "Should not be negative, but is %d", rules.VaccinationValidityDays)
+	}
+
+	validateVaccinationProductRules(field+".vaccinationProductRules", rules.VaccinationProductRules, addIssue)
+
+	if rules.VaccinationJanssenValidityIntoForceDateStr != "" {
+		_, err := time.Parse(YYYYMMDD_FORMAT, rules.VaccinationJanssenValidityIntoForceDateStr)
+		if err != nil {
+			addIssue(field+".vaccinationJanssenValidityDelayIntoForceDate", "Could not parse date '%s'", rules.VaccinationJanssenValidityIntoForceDateStr)
+		}
+	}
+
+	if len(rules.VaccineAllowedProducts) == 0 {
+		addIssue(field+".vaccineAllowedProducts", "Should not be empty")
+	}
+
+	if rules.RecoveryValidFromDays < 0 {
+		addIssue(field+".recoveryValidFromDays", "Should not be negative, but is %d", rules.RecoveryValidFromDays)
+	}
+
+	if rules.RecoveryValidUntilDays <= 0 {
+		addIssue(field+".recoveryValidUntilDays", "Should be positive, but is %d", rules.RecoveryValidUntilDays)
+	}
+
+	if rules.RecoveryValidFromDays > rules.RecoveryValidUntilDays {
+		addIssue(
+			field+".recoveryValidFromDays",
+			"Should not be after recoveryValidUntilDays, but %d > %d",
+			rules.RecoveryValidFromDays, rules.RecoveryValidUntilDays,
+		)
+	}
+
+	validateDenylist(field+".proofIdentifierDenylist", rules.ProofIdentifierDenylist, addIssue)
+	validateBusinessRules(field+".businessRules", rules.BusinessRules, addIssue)
+}
+
+func validateDenylist(field string, denylist map[string]bool, addIssue func(field string, format string, a ...interface{})) {
+	// Sort the proof identifiers, so that the issues are reported in a stable order
+	proofIdentifiersBase64 := make([]string, 0, len(denylist))
+	for proofIdentifierBase64 := range denylist {
+		proofIdentifiersBase64 = append(proofIdentifiersBase64, proofIdentifierBase64)
+	}
+
+	sort.Strings(proofIdentifiersBase64)
+
+	for _, proofIdentifierBase64 := range proofIdentifiersBase64 {
+		_, err := base64.StdEncoding.DecodeString(proofIdentifierBase64)
+		if err != nil {
+			addIssue(field, "Could not base64 decode proof identifier '%s'", proofIdentifierBase64)
+		}
+	}
+}
+
+func validateVaccinationProductRules(field string, productRules []*vaccinationProductRule, addIssue func(field string, format string, a ...interface{})) {
+	medicinalProducts := map[string]bool{}
+	for _, productRule := range productRules {
+		if productRule == nil || productRule.MedicinalProduct == "" {
+			addIssue(field, "Should not contain a rule without medicinal product")
+			continue
+		}
+
+		product := productRule.MedicinalProduct
+		if medicinalProducts[product] {
+			addIssue(field, "Product %s has more than one rule", product)
+		}
+
+		medicinalProducts[product] = true
+
+		if productRule.ValidityDelayDays != nil && *productRule.ValidityDelayDays < 0 {
+			addIssue(field, "Product %s should not have a negative validityDelayDays", product)
+		}
+
+		if productRule.ValidityDays != nil && *productRule.ValidityDays < 0 {
+			addIssue(field, "Product %s should not have a negative validityDays", product)
+		}
+
+		if productRule.PrimarySeriesDoses < 0 || productRule.BoosterValidityDelayDays < 0 {
+			addIssue(field, "Product %s should not have negative booster settings", product)
+		}
+
+		if productRule.ValidityDelayIntoForceDateStr != "" {
+			_, err := time.Parse(YYYYMMDD_FORMAT, productRule.ValidityDelayIntoForceDateStr)
+			if err != nil {
+				addIssue(field, "Product %s has unparseable validityDelayIntoForceDate '%s'", product, productRule.ValidityDelayIntoForceDateStr)
+			}
+		}
+	}
+}
+
+func validateAllowedTestDevices(field string, devices []*allowedTestDevice, addIssue func(field string, format string, a ...interface{})) {
+	identifiers := map[string]bool{}
+	for _, device := range devices {
+		if device == nil || device.Identifier == "" {
+			addIssue(field, "Should not contain a device without identifier")
+			continue
+		}
+
+		if identifiers[device.Identifier] {
+			addIssue(field, "Device %s is listed more than once", device.Identifier)
+		}
+
+		identifiers[device.Identifier] = true
+
+		var validFrom, validUntil time.Time
+		var err error
+		if device.ValidFromStr != "" {
+			validFrom, err = time.Parse(YYYYMMDD_FORMAT, device.ValidFromStr)
+			if err != nil {
+				addIssue(field, "Device %s has unparseable validFrom '%s'", device.Identifier, device.ValidFromStr)
+			}
+		}
+
+		if device.ValidUntilStr != "" {
+			validUntil, err = time.Parse(YYYYMMDD_FORMAT, device.ValidUntilStr)
+			if err != nil {
+				addIssue(field, "Device %s has unparseable validUntil '%s'", device.Identifier, device.ValidUntilStr)
+			}
+		}
+
+		if !validFrom.IsZero() && !validUntil.IsZero() && validUntil.Before(validFrom) {
+			addIssue(field, "Device %s should not be valid until before it is valid from", device.Identifier)
+		}
+	}
+}
+
+func configIssuesError(issues configIssues) error {
+	messages := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		messages = append(messages, issue.Field+": "+issue.Message)
+	}
+
+	return errors.Errorf("The config has %d issue(s): %s", len(issues), strings.Join(messages, "; "))
+}
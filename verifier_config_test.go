@@ -0,0 +1,322 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestValidateVerifierConfig(t *testing.T) {
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	// The testdata config should not have any issues
+	r1 := ValidateVerifierConfig(configJson)
+	if r1.Error != "" || string(r1.Value) != "[]" {
+		t.Fatal("Expected no issues for the testdata config:", r1.Error, string(r1.Value))
+	}
+
+	// Break a number of rules at once
+	brokenConfigJson := []byte(`{
+		"domesticVerificationRules": {
+			"qrValidForSeconds": 0,
+			"proofIdentifierDenylist": {"not base64!": true},
+			"paperProofMaxValidityHours": -1
+		},
+		"europeanVerificationRules": {
+			"testAllowedTypes": [],
+			"testValidityHours": -1,
+			"vaccinationValidityDelayDays": 14,
+			"vaccinationJanssenValidityDelayDays": 28,
+			"vaccinationJanssenValidityDelayIntoForceDate": "2021-14-08",
+			"vaccineAllowedProducts": ["EU/1/20/1528"],
+			"recoveryValidFromDays": 200,
+			"recoveryValidUntilDays": 180
+		}
+	}`)
+
+	r2 := ValidateVerifierConfig(brokenConfigJson)
+	if r2.Error != "" {
+		t.Fatal("Could not validate broken config:", r2.Error)
+	}
+
+	var issues []*ConfigIssue
+	err = json.Unmarshal(r2.Value, &issues)
+	if err != nil {
+		t.Fatal("Could not unmarshal issues:", err)
+	}
+
+	expectedFields := []string{
+		"domesticVerificationRules.qrValidForSeconds",
+		"domesticVerificationRules.proofIdentifierDenylist",
+		"domesticVerificationRules.paperProofMaxValidityHours",
+		"europeanVerificationRules.testAllowedTypes",
+		"europeanVerificationRules.testValidityHours",
+		"europeanVerificationRules.vaccinationJanssenValidityDelayIntoForceDate",
+		"europeanVerificationRules.recoveryValidFromDays",
+	}
+
+	if len(issues) != len(expectedFields) {
+		t.Fatal("Expected", len(expectedFields), "issues, got", len(issues), string(r2.Value))
+	}
+
+	for i, field := range expectedFields {
+		if issues[i].Field != field {
+			t.Fatal("Expected issue for field", field, "but got", issues[i].Field)
+		}
+	}
+
+	// A broken config is refused
+	_, err = NewVerifier(brokenConfigJson, &PublicKeysConfig{}, time.Now())
+	if err == nil {
+		t.Fatal("A verifier should not be created with a broken config")
+	}
+
+	// Missing rules are reported as well
+	r3 := ValidateVerifierConfig([]byte(`{}`))
+	err = json.Unmarshal(r3.Value, &issues)
+	if err != nil || len(issues) != 2 {
+		t.Fatal("Expected issues for both missing verification rules", r3.Error)
+	}
+
+	r4 := ValidateVerifierConfig([]byte(`{`))
+	if r4.ErrorCode != ERROR_CODE_INVALID_CONFIG {
+		t.Fatal("Expected invalid config error code for invalid JSON, got", r4.ErrorCode)
+	}
+}
+
+func TestUpdateConfigAndPublicKeys(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksJson, err := os.ReadFile("./testdata/public_keys.json")
+	if err != nil {
+		t.Fatal("Could not read public keys", err)
+	}
+
+	// Updating an uninitialized verifier is not possible
+	err = (&Verifier{}).UpdateConfig(configJson)
+	if getErrorCode(err) != ERROR_CODE_NOT_INITIALIZED {
+		t.Fatal("Expected not initialized error code when updating the config of an uninitialized verifier")
+	}
+
+	pksConfig, err := NewPublicKeysConfigFromJson(pksJson, true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	v, err := NewVerifier(configJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	// Verifying a domestic QR loads its public key
+	v.verify(deniedQr, now)
+
+	var loadedKid string
+	for kid, annotatedPk := range pksConfig.DomesticPks {
+		if annotatedPk.LoadedPk != nil {
+			loadedKid = kid
+		}
+	}
+
+	if loadedKid == "" {
+		t.Fatal("Expected the domestic public key to be loaded")
+	}
+
+	// Update the config only, without the European denylist entry
+	otherConfigJson := []byte(strings.Replace(string(configJson), "7EXmXBhfyBZJgt1dki0cfQ==", "", 1))
+	err = v.UpdateConfig(otherConfigJson)
+	if err != nil {
+		t.Fatal("Could not update config", err)
+	}
+
+	r1 := v.verify(denylistedQR, now)
+	if r1.Status != VERIFICATION_FAILED_IS_NL_DCC {
+		t.Fatal("The updated config should have been used", r1.Error)
+	}
+
+	if v.getSnapshot().publicKeysConfig != pksConfig {
+		t.Fatal("The public keys config should not change when updating the config")
+	}
+
+	err = v.UpdateConfig([]byte(`{}`))
+	if err == nil {
+		t.Fatal("An invalid config should not be applied")
+	}
+
+	// Update the public keys only, which takes over the loaded domestic public key
+	otherPksConfig, err := NewPublicKeysConfigFromJson(pksJson, true)
+	if err != nil {
+		t.Fatal("Could not load other public keys config", err)
+	}
+
+	err = v.UpdatePublicKeys(otherPksConfig)
+	if err != nil {
+		t.Fatal("Could not update public keys", err)
+	}
+
+	if otherPksConfig.DomesticPks[loadedKid].LoadedPk != pksConfig.DomesticPks[loadedKid].LoadedPk {
+		t.Fatal("The loaded domestic public key should have been taken over")
+	}
+
+	// Taking over in both directions at the same time should not deadlock
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			pksConfig.takeOverLoadedDomesticPks(otherPksConfig)
+		}()
+		go func() {
+			defer wg.Done()
+			otherPksConfig.takeOverLoadedDomesticPks(pksConfig)
+		}()
+	}
+	wg.Wait()
+
+	r2 := v.verify(denylistedQR, now)
+	if r2.Status != VERIFICATION_FAILED_IS_NL_DCC {
+		t.Fatal("The config should not change when updating the public keys", r2.Error)
+	}
+
+	// The package level functions update the default verifier
+	r3 := UpdatePublicKeys(pksJson)
+	if r3.Error != "" {
+		t.Fatal("Could not update public keys of the default verifier", r3.Error)
+	}
+
+	r4 := UpdateVerifierConfig([]byte(`{`))
+	if r4.ErrorCode != ERROR_CODE_INVALID_CONFIG {
+		t.Fatal("Expected invalid config error code, got", r4.ErrorCode)
+	}
+
+	r5 := UpdateVerifierConfig(configJson)
+	if r5.Error != "" {
+		t.Fatal("Could not update config of the default verifier", r5.Error)
+	}
+}
+
+func TestConfigStaleness(t *testing.T) {
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	v, err := NewVerifier(configJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	status, err := v.ConfigStatus()
+	if err != nil || status.IsStale || status.IsExpired {
+		t.Fatal("A freshly loaded config should not be stale", err)
+	}
+
+	// The testdata config has a TTL of a day, without grace period
+	now := time.Now()
+	err = v.SetConfigFetchedAt(now.Add(-48 * time.Hour))
+	if err != nil {
+		t.Fatal("Could not set config fetch time", err)
+	}
+
+	status, err = v.ConfigStatus()
+	if err != nil || !status.IsStale || !status.IsExpired {
+		t.Fatal("A config fetched two days ago should be stale and expired", err)
+	}
+
+	r1 := v.verify(defaultQR, now)
+	if r1.Status != VERIFICATION_FAILED_CONFIG_EXPIRED {
+		t.Fatal("Expected the config expired status, got", r1.Status)
+	}
+
+	// Updating or reloading the config doesn't make it fresh, as only its fetch time does
+	err = v.UpdateConfig(configJson)
+	if err != nil {
+		t.Fatal("Could not update config", err)
+	}
+
+	err = v.Reload(configJson, pksConfig)
+	if err != nil {
+		t.Fatal("Could not reload config", err)
+	}
+
+	status, err = v.ConfigStatus()
+	if err != nil || !status.IsExpired {
+		t.Fatal("An updated config should keep its fetch time", err)
+	}
+
+	// With a grace period of two days the config is only stale
+	graceConfigJson := []byte(strings.Replace(string(configJson), `"configTTL": 86400,`, `"configTTL": 86400, "configGracePeriodSeconds": 172800,`, 1))
+	err = v.UpdateConfig(graceConfigJson)
+	if err != nil {
+		t.Fatal("Could not update config", err)
+	}
+
+	err = v.SetConfigFetchedAt(now.Add(-48 * time.Hour))
+	if err != nil {
+		t.Fatal("Could not set config fetch time", err)
+	}
+
+	status, err = v.ConfigStatus()
+	if err != nil || !status.IsStale || status.IsExpired {
+		t.Fatal("A config fetched two days ago should only be stale within the grace period", err)
+	}
+
+	r2 := v.verify(defaultQR, now)
+	if r2.Status == VERIFICATION_FAILED_CONFIG_EXPIRED {
+		t.Fatal("The config should not be expired within the grace period")
+	}
+
+	// A deactivated app doesn't verify anything
+	deactivatedConfigJson := []byte(strings.Replace(string(configJson), `"appDeactivated": false`, `"appDeactivated": true`, 1))
+	err = v.UpdateConfig(deactivatedConfigJson)
+	if err != nil {
+		t.Fatal("Could not update config", err)
+	}
+
+	r3 := v.verify(defaultQR, time.Unix(1627462000, 0))
+	if r3.Status != VERIFICATION_FAILED_APP_DEACTIVATED {
+		t.Fatal("Expected the app deactivated status, got", r3.Status)
+	}
+
+	// The default verifier has been freshly initialized
+	r4 := GetVerifierConfigStatus()
+	if r4.Error != "" {
+		t.Fatal("Could not get config status", r4.Error)
+	}
+
+	var defaultStatus *VerifierConfigStatus
+	err = json.Unmarshal(r4.Value, &defaultStatus)
+	if err != nil || defaultStatus.IsStale || defaultStatus.FetchedAt == 0 {
+		t.Fatal("Expected a fresh config status for the default verifier", err)
+	}
+
+	// Initializing with a config that was fetched two days ago doesn't make it fresh
+	r5 := InitializeVerifier("./testdata", now.Add(-48*time.Hour).Unix())
+	if r5.Error != "" {
+		t.Fatal("Could not initialize verifier", r5.Error)
+	}
+
+	status, err = defaultVerifier.ConfigStatus()
+	if err != nil || !status.IsExpired || status.FetchedAt != now.Add(-48*time.Hour).Unix() {
+		t.Fatal("Expected the given fetch time to be used when initializing", err)
+	}
+
+	// Restore the default instances for the other tests
+	TestInitialization(t)
+}
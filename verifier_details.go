@@ -0,0 +1,130 @@
+package mobilecore
+
+import (
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VerificationDetailsV2 contains the same details as VerificationDetails, but with properly typed
+// values. An unknown or hidden birth day or month is zero.
+type VerificationDetailsV2 struct {
+	CredentialVersion int    `json:"credentialVersion"`
+	IsSpecimen        bool   `json:"isSpecimen"`
+	IssuerCountryCode string `json:"issuerCountryCode"`
+
+	FirstNameInitial string `json:"firstNameInitial"`
+	LastNameInitial  string `json:"lastNameInitial"`
+	BirthDay         int    `json:"birthDay"`
+	BirthMonth       int    `json:"birthMonth"`
+	HiddenAttributes string `json:"hiddenAttributes"`
+
+	VerificationPolicy string `json:"verificationPolicy"`
+
+	// Only present when the extended details were requested
+	Statement *StatementDetails `json:"statement"`
+}
+
+// StatementDetails summarizes why and until when a proof is valid. The validity window consists
+// of unix timestamps, as computed by the rules, in which a zero valid until means no expiry.
+// The window is entirely zero when business rules replace the built-in European rules.
+// The statement type, dose numbers and test type are only known for European proofs.
+type StatementDetails struct {
+	Type       string `json:"type"`
+	ValidFrom  int64  `json:"validFrom"`
+	ValidUntil int64  `json:"validUntil"`
+
+	DoseNumber         int    `json:"doseNumber"`
+	TotalSeriesOfDoses int    `json:"totalSeriesOfDoses"`
+	TypeOfTest         string `json:"typeOfTest"`
+}
+
+func newVerificationDetailsV2(details *VerificationDetails) *VerificationDetailsV2 {
+	// The string values have been validated before, so unparseable values are only the unknown ones
+	credentialVersion, _ := strconv.Atoi(details.CredentialVersion)
+	birthDay, _ := strconv.Atoi(details.BirthDay)
+	birthMonth, _ := strconv.Atoi(details.BirthMonth)
+
+	return &VerificationDetailsV2{
+		CredentialVersion: credentialVersion,
+		IsSpecimen:        details.IsSpecimen == "1",
+		IssuerCountryCode: details.IssuerCountryCode,
+
+		FirstNameInitial: details.FirstNameInitial,
+		LastNameInitial:  details.LastNameInitial,
+		BirthDay:         birthDay,
+		BirthMonth:       birthMonth,
+		HiddenAttributes: details.HiddenAttributes,
+
+		VerificationPolicy: details.VerificationPolicy,
+	}
+}
+
+// buildEuropeanStatementDetails summarizes the single statement of a validated DCC, with the
+// same validity window as holders get for it
+func buildEuropeanStatementDetails(dcc *hcertcommon.DCC, rules *europeanVerificationRules) (*StatementDetails, error) {
+	statement := &StatementDetails{
+		Type: getStatementType(dcc),
+	}
+
+	var validFrom, validUntil time.Time
+	var err error
+	switch statement.Type {
+	case STATEMENT_TYPE_VACCINATION:
+		vacc := dcc.Vaccinations[0]
+		statement.DoseNumber = vacc.DoseNumber
+		statement.TotalSeriesOfDoses = vacc.TotalSeriesOfDoses
+		validFrom, validUntil, err = europeanStatementValidity(vacc, rules)
+	case STATEMENT_TYPE_RECOVERY:
+		validFrom, validUntil, err = europeanStatementValidity(dcc.Recoveries[0], rules)
+	case STATEMENT_TYPE_TEST:
+		test := dcc.Tests[0]
+		statement.TypeOfTest = strings.TrimSpace(test.TypeOfTest)
+		validFrom, validUntil, err = europeanStatementValidity(test, rules)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	statement.ValidFrom = unixOrZero(validFrom)
+	statement.ValidUntil = unixOrZero(validUntil)
+
+	return statement, nil
+}
+
+// europeanStatementValidity computes the validity window of a single vaccination, test or recovery
+// with the built-in rules, which both holders and verifiers are shown. As a vaccination is accepted
+// during the whole day on which it expires, its valid until is the end of that day. When business
+// rules replace the built-in rules the window can't be computed, so that it is left zero.
+func europeanStatementValidity(statement interface{}, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
+	if len(rules.BusinessRules) != 0 {
+		return time.Time{}, time.Time{}, nil
+	}
+
+	switch s := statement.(type) {
+	case *hcertcommon.DCCVaccination:
+		validFrom, validUntil, err = checkVaccination(s, rules)
+		if err == nil && !validUntil.IsZero() {
+			validUntil = validUntil.AddDate(0, 0, 1)
+		}
+	case *hcertcommon.DCCTest:
+		validFrom, validUntil, err = checkTest(s, rules)
+	case *hcertcommon.DCCRecovery:
+		validFrom, validUntil, err = checkRecovery(s, rules)
+	default:
+		err = errors.Errorf("Unknown kind of statement")
+	}
+
+	return validFrom, validUntil, err
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.Unix()
+}
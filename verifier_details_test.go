@@ -0,0 +1,64 @@
+package mobilecore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVerificationDetailsV2(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	// The vaccination of the default QR is from 2021-07-10, and is valid after 14 days
+	r1 := defaultVerifier.verifyWithOptions(defaultQR, &verificationOptions{extendedDetails: true}, now)
+	if r1.Status != VERIFICATION_SUCCESS {
+		t.Fatal("Could not verify default QR", r1.Error)
+	}
+
+	if *r1.DetailsV2.Statement != (StatementDetails{
+		Type:               STATEMENT_TYPE_VACCINATION,
+		ValidFrom:          time.Date(2021, 7, 24, 0, 0, 0, 0, time.UTC).Unix(),
+		DoseNumber:         2,
+		TotalSeriesOfDoses: 2,
+	}) {
+		t.Fatal("Unexpected vaccination statement details", *r1.DetailsV2.Statement)
+	}
+
+	r2 := defaultVerifier.verify(defaultQR, now)
+	if r2.DetailsV2 == nil || r2.DetailsV2.Statement != nil {
+		t.Fatal("Expected typed details without statement when not extended")
+	}
+
+	if r2.DetailsV2.CredentialVersion != 1 || r2.DetailsV2.IssuerCountryCode != r2.Details.IssuerCountryCode {
+		t.Fatal("Expected the typed details to correspond to the details")
+	}
+
+	// Unknown birth days and months are zero
+	detailsV2 := newVerificationDetailsV2(&VerificationDetails{CredentialVersion: "1", IsSpecimen: "1", BirthDay: DOB_EMPTY_VALUE, BirthMonth: "05"})
+	if detailsV2.BirthDay != 0 || detailsV2.BirthMonth != 5 || !detailsV2.IsSpecimen {
+		t.Fatal("Unexpected typed details", *detailsV2)
+	}
+
+	// Tests and recoveries
+	rules := defaultVerifier.getSnapshot().config.EuropeanVerificationRules
+	testStatement, err := buildEuropeanStatementDetails(getHcert("T", nil).DCC, rules)
+	if err != nil {
+		t.Fatal("Could not build test statement details", err)
+	}
+
+	doc := time.Date(2021, 7, 22, 20, 22, 0, 0, time.UTC)
+	if testStatement.Type != STATEMENT_TYPE_TEST || testStatement.TypeOfTest != "LP6464-4" ||
+		testStatement.ValidFrom != doc.Unix() || testStatement.ValidUntil != doc.Add(25*time.Hour).Unix() {
+		t.Fatal("Unexpected test statement details", *testStatement)
+	}
+
+	recStatement, err := buildEuropeanStatementDetails(getHcert("R", nil).DCC, rules)
+	if err != nil {
+		t.Fatal("Could not build recovery statement details", err)
+	}
+
+	if recStatement.Type != STATEMENT_TYPE_RECOVERY ||
+		recStatement.ValidFrom != time.Date(2021, 7, 12, 0, 0, 0, 0, time.UTC).Unix() ||
+		recStatement.ValidUntil != time.Date(2021, 9, 12, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Fatal("Unexpected recovery statement details", *recStatement)
+	}
+}
@@ -2,32 +2,74 @@ package mobilecore
 
 import (
 	"github.com/go-errors/errors"
+	idemixverifier "github.com/minvws/nl-covid19-coronacheck-idemix/verifier"
 	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
-func verifyDomestic(proof []byte, rules *domesticVerificationRules, now time.Time) (verificationDetails *VerificationDetails, err error) {
-	verifiedCred, err := domesticVerifier.VerifyQREncoded(proof)
+func (vs *verifierSnapshot) verifyDomestic(proof []byte, rules *domesticVerificationRules, policy *verificationPolicy, now time.Time) (verificationDetails *VerificationDetails, statement *StatementDetails, err error) {
+	// Selective proofs are verified within mobilecore, as the idemix verifier only accepts full disclosure
+	var verifiedCred *idemixverifier.VerifiedCredential
+	var hiddenAttributes []string
+	if isSelectiveProof(proof) {
+		verifiedCred, hiddenAttributes, err = verifySelectiveQREncoded(vs.publicKeysConfig.FindAndCacheDomestic, proof)
+	} else {
+		verifiedCred, err = vs.domesticVerifier.VerifyQREncoded(proof)
+	}
+
+	if err != nil {
+		return nil, nil, withFailureReason(err, FAILURE_REASON_INVALID_PROOF)
+	}
+
+	err = checkHiddenAttributes(hiddenAttributes)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	err = vs.revocationLists.checkDomesticRevocation(verifiedCred)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	err = checkDenylist(verifiedCred.ProofIdentifier, rules.ProofIdentifierDenylist)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	attributes := verifiedCred.Attributes
-	err = checkValidity(attributes["validFrom"], attributes["validForHours"], now)
+	isPaperProof := attributes["isPaperProof"]
+	if isPaperProof == "1" {
+		err = checkDenylist(verifiedCred.ProofIdentifier, rules.PaperProofIdentifierDenylist)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	validFrom, validUntil, err := domesticValidity(attributes["validFrom"], attributes["validForHours"])
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if isPaperProof == "1" {
+		validUntil = limitPaperProofValidity(validFrom, validUntil, rules)
+	}
+
+	err = checkValidity(validFrom, validUntil, now)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	isPaperProof := attributes["isPaperProof"]
 	err = checkFreshness(verifiedCred.DisclosureTimeSeconds, isPaperProof, rules, now)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	// Credentials without category attribute have an empty category
+	err = policy.checkDomesticCategory(attributes["category"])
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// Build details
@@ -40,33 +82,46 @@ func verifyDomestic(proof []byte, rules *domesticVerificationRules, now time.Tim
 		LastNameInitial:  attributes["lastNameInitial"],
 		BirthDay:         attributes["birthDay"],
 		BirthMonth:       attributes["birthMonth"],
+		HiddenAttributes: strings.Join(hiddenAttributes, ","),
+
+		VerificationPolicy: policy.Identifier,
 	}
 
-	return verificationDetails, nil
+	statement = &StatementDetails{
+		ValidFrom:  validFrom.Unix(),
+		ValidUntil: validUntil.Unix(),
+	}
+
+	return verificationDetails, statement, nil
 }
 
-func checkValidity(validFromStr string, validForHoursStr string, now time.Time) error {
-	validFrom, err := strconv.ParseInt(validFromStr, 10, 64)
-	if err != nil {
-		return errors.WrapPrefix(err, "Could not parse validFrom as int", 0)
+func checkValidity(validFrom, validUntil time.Time, now time.Time) error {
+	if now.Before(validFrom) {
+		return validityFailuref(FAILURE_REASON_CREDENTIAL_NOT_YET_VALID, validFrom, validUntil, "The credential is not yet valid")
 	}
 
-	validForHours, err := strconv.ParseInt(validForHoursStr, 10, 0)
-	if err != nil {
-		return errors.WrapPrefix(err, "Could not parse validForHours as int", 0)
+	if !now.Before(validUntil) {
+		return validityFailuref(FAILURE_REASON_CREDENTIAL_EXPIRED, validFrom, validUntil, "The credential is not valid anymore")
 	}
 
-	unixTimeNow := now.UTC().Unix()
-	if unixTimeNow < validFrom {
-		return errors.Errorf("The credential is not yet valid")
+	return nil
+}
+
+// domesticValidity computes the validity window of a domestic credential from its attributes
+func domesticValidity(validFromStr string, validForHoursStr string) (validFrom, validUntil time.Time, err error) {
+	validFromUnix, err := strconv.ParseInt(validFromStr, 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.WrapPrefix(withFailureReason(err, FAILURE_REASON_INVALID_ATTRIBUTES), "Could not parse validFrom as int", 0)
 	}
 
-	validUntil := validFrom + validForHours*60*60
-	if unixTimeNow >= validUntil {
-		return errors.Errorf("The credential is not valid anymore")
+	validForHours, err := strconv.ParseInt(validForHoursStr, 10, 0)
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.WrapPrefix(withFailureReason(err, FAILURE_REASON_INVALID_ATTRIBUTES), "Could not parse validForHours as int", 0)
 	}
 
-	return nil
+	validUntilUnix := validFromUnix + validForHours*60*60
+
+	return time.Unix(validFromUnix, 0), time.Unix(validUntilUnix, 0), nil
 }
 
 func checkFreshness(generatedAtTimestamp int64, isPaperProofStr string, rules *domesticVerificationRules, now time.Time) error {
@@ -79,8 +134,22 @@ func checkFreshness(generatedAtTimestamp int64, isPaperProofStr string, rules *d
 	unixTimeNow := now.UTC().Unix()
 	qrValidForSeconds := float64(rules.QRValidForSeconds)
 	if math.Abs(float64(unixTimeNow)-float64(generatedAtTimestamp)) > qrValidForSeconds {
-		return errors.Errorf("The credential has been generated too long ago, or clock skew is too large")
+		return failuref(FAILURE_REASON_QR_TOO_OLD, "The credential has been generated too long ago, or clock skew is too large")
 	}
 
 	return nil
 }
+
+// limitPaperProofValidity shortens the validity of a paper proof to the configured maximum, if any
+func limitPaperProofValidity(validFrom, validUntil time.Time, rules *domesticVerificationRules) time.Time {
+	if rules.PaperProofMaxValidityHours == 0 {
+		return validUntil
+	}
+
+	maxValidUntil := validFrom.Add(time.Duration(rules.PaperProofMaxValidityHours) * time.Hour)
+	if validUntil.After(maxValidUntil) {
+		return maxValidUntil
+	}
+
+	return validUntil
+}
@@ -1,6 +1,8 @@
 package mobilecore
 
 import (
+	"encoding/base64"
+	"github.com/fxamacker/cbor/v2"
 	"github.com/go-errors/errors"
 	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
 	"github.com/minvws/nl-covid19-coronacheck-hcert/verifier"
@@ -14,6 +16,7 @@ const (
 	DISEASE_TARGETED_COVID_19               = "840539006"
 	TEST_RESULT_NOT_DETECTED                = "260415000"
 	VACCINE_MEDICINAL_PRODUCT_JANSSEN       = "EU/1/20/1525"
+	TEST_TYPE_RAPID_ANTIGEN                 = "LP217198-3"
 
 	YYYYMMDD_FORMAT = "2006-01-02"
 	DOB_EMPTY_VALUE = "XX"
@@ -28,48 +31,153 @@ var (
 	}
 )
 
-func verifyEuropean(proofQREncoded []byte, rules *europeanVerificationRules, now time.Time) (details *VerificationDetails, isNLDCC bool, err error) {
+func (vs *verifierSnapshot) verifyEuropean(proofQREncoded []byte, arrival, departure *countryRules, policy *verificationPolicy, now time.Time) (details *VerificationDetails, statement *StatementDetails, isNLDCC bool, err error) {
 	// Validate signature and get health certificate
-	verified, err := europeanVerifier.VerifyQREncoded(proofQREncoded)
+	verified, err := vs.europeanVerifier.VerifyQREncoded(proofQREncoded)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, withFailureReason(err, vs.europeanVerificationFailureReason(proofQREncoded))
 	}
 
 	hcert := verified.HealthCertificate
 	pk := verified.PublicKey
 
-	// Check denylist
-	err = checkDenylist(verified.ProofIdentifier, rules.ProofIdentifierDenylist)
+	// The rules of the country of departure, if any, must be passed as well as those of the country of arrival
+	countries := []*countryRules{arrival}
+	if departure != nil && departure.countryCode != arrival.countryCode {
+		countries = append(countries, departure)
+	}
+
+	// Check denylists. The denylist of the Netherlands always applies, whatever the countries are.
+	denylists := []map[string]bool{vs.config.EuropeanVerificationRules.ProofIdentifierDenylist}
+	for _, country := range countries {
+		if country.countryCode != DEFAULT_COUNTRY_OF_ARRIVAL {
+			denylists = append(denylists, country.rules.ProofIdentifierDenylist)
+		}
+	}
+
+	for _, denylist := range denylists {
+		err = checkDenylist(verified.ProofIdentifier, denylist)
+		if err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	err = vs.revocationLists.checkEuropeanRevocation(proofQREncoded, hcert)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
 	}
 
-	// Exit early if it's an NL-issued CWT, so domestic credentials must be used instead
+	// Exit early if it's an NL-issued CWT in the Netherlands, so domestic credentials must be used instead
 	// As the constituent countries don't have domestic credentials, check if the subject alternative name
 	//  of the public key is present and NLD. In that case European credentials are allowed.
-	if hcert.Issuer == "NL" && (len(pk.SubjectAltName) != 3 || pk.SubjectAltName == "NLD") {
-		return nil, true, nil
+	isNLIssued := hcert.Issuer == "NL" && (len(pk.SubjectAltName) != 3 || pk.SubjectAltName == "NLD")
+	if isNLIssued && arrival.countryCode == DEFAULT_COUNTRY_OF_ARRIVAL {
+		return nil, nil, true, nil
 	}
 
 	// Validate health certificate metadata, and see if it's a specimen certificate
 	isSpecimen, err := validateHcert(hcert, now)
 	if err != nil {
-		return nil, false, errors.WrapPrefix(err, "Could not validate health certificate", 0)
+		return nil, nil, false, errors.WrapPrefix(err, "Could not validate health certificate", 0)
 	}
 
-	// Validate DCC
-	err = validateDCC(hcert.DCC, rules, now)
+	// Validate the coded fields against the EU value sets, if these are loaded
+	err = validateDCCCodes(hcert.DCC, vs.valueSets)
 	if err != nil {
-		return nil, false, errors.WrapPrefix(err, "Could not validate DCC", 0)
+		return nil, nil, false, errors.WrapPrefix(err, "Could not validate DCC codes", 0)
+	}
+
+	// Validate DCC against the rules of every country
+	for _, country := range countries {
+		err = vs.validateDCCForCountry(hcert, country, now)
+		if err != nil {
+			return nil, nil, false, errors.WrapPrefix(err, "Could not validate DCC for country "+country.countryCode, 0)
+		}
+	}
+
+	// Check whether the statement is accepted by the policy of this scan
+	err = policy.checkStatementType(hcert.DCC)
+	if err != nil {
+		return nil, nil, false, err
 	}
 
 	// Build the resulting details
 	result, err := buildVerificationDetails(hcert, pk, isSpecimen)
 	if err != nil {
-		return nil, false, err
+		return nil, nil, false, err
+	}
+
+	result.VerificationPolicy = policy.Identifier
+
+	// Summarize the statement according to the rules of the country of arrival
+	statement, err = buildEuropeanStatementDetails(hcert.DCC, arrival.rules)
+	if err != nil {
+		return nil, nil, false, errors.WrapPrefix(err, "Could not build statement details", 0)
+	}
+
+	return result, statement, false, nil
+}
+
+// validateDCCForCountry validates the DCC against the business rules of the country if these
+// are configured, or else against the built-in rules
+func (vs *verifierSnapshot) validateDCCForCountry(hcert *hcertcommon.HealthCertificate, country *countryRules, now time.Time) error {
+	if len(country.rules.BusinessRules) != 0 {
+		return validateDCCWithBusinessRules(hcert, country.rules, vs.valueSets, country.countryCode, now)
+	}
+
+	return validateDCC(hcert.DCC, country.rules, now)
+}
+
+// europeanVerificationFailureReason distinguishes an unknown key from other failures when
+// the signature of a European QR code could not be verified
+func (vs *verifierSnapshot) europeanVerificationFailureReason(proofQREncoded []byte) string {
+	kid, err := readEuropeanKID(proofQREncoded)
+	if err != nil {
+		return FAILURE_REASON_INVALID_PROOF
+	}
+
+	_, ok := vs.europeanPks[base64.StdEncoding.EncodeToString(kid)]
+	if !ok {
+		return FAILURE_REASON_UNKNOWN_KEY
+	}
+
+	return FAILURE_REASON_INVALID_PROOF
+}
+
+// readEuropeanKID finds the key identifier of a European QR code in the same way as the hcert
+// verifier, which doesn't expose it: from the protected header, or else the unprotected header
+func readEuropeanKID(proofQREncoded []byte) ([]byte, error) {
+	cwt, err := hcertcommon.UnmarshalQREncoded(proofQREncoded)
+	if err != nil {
+		return nil, err
 	}
 
-	return result, false, nil
+	kid, _, err := readEuropeanCWTHeader(cwt)
+	return kid, err
+}
+
+// readEuropeanCWTHeader returns the key identifier as found by readEuropeanKID, together with the
+// signature algorithm of the protected header
+func readEuropeanCWTHeader(cwt *hcertcommon.CWT) (kid []byte, alg int, err error) {
+	var protectedHeader *hcertcommon.CWTHeader
+	err = cbor.Unmarshal(cwt.Protected, &protectedHeader)
+	if err != nil {
+		return nil, 0, errors.WrapPrefix(err, "Could not CBOR unmarshal protected header", 0)
+	}
+
+	if protectedHeader == nil {
+		return nil, 0, errors.Errorf("No protected header is present in CWT")
+	}
+
+	if protectedHeader.KID != nil {
+		return protectedHeader.KID, protectedHeader.Alg, nil
+	}
+
+	if cwt.Unprotected.KID != nil {
+		return cwt.Unprotected.KID, protectedHeader.Alg, nil
+	}
+
+	return nil, 0, errors.Errorf("Could not find key identifier in protected or unprotected header")
 }
 
 func validateHcert(hcert *hcertcommon.HealthCertificate, now time.Time) (isSpecimen bool, err error) {
@@ -83,21 +191,31 @@ func validateHcert(hcert *hcertcommon.HealthCertificate, now time.Time) (isSpeci
 	expirationTime := time.Unix(hcert.ExpirationTime, 0)
 
 	if expirationTime.Before(issuedAt) {
-		return false, errors.Errorf("Cannot be issued after it expires")
+		return false, failuref(FAILURE_REASON_HCERT_INVALID_VALIDITY, "Cannot be issued after it expires")
 	}
 
 	if now.Before(issuedAt) {
-		return false, errors.Errorf("Is issued before the current time")
+		return false, validityFailuref(FAILURE_REASON_HCERT_NOT_YET_VALID, issuedAt, expirationTime, "Is issued before the current time")
 	}
 
 	if expirationTime.Before(now) {
-		return false, errors.Errorf("Is not valid anymore; was valid until %d", hcert.ExpirationTime)
+		return false, validityFailuref(FAILURE_REASON_HCERT_EXPIRED, issuedAt, expirationTime, "Is not valid anymore; was valid until %d", hcert.ExpirationTime)
 	}
 
 	return false, nil
 }
 
 func validateDCC(dcc *hcertcommon.DCC, rules *europeanVerificationRules, now time.Time) (err error) {
+	err = validateDCCStructure(dcc)
+	if err != nil {
+		return err
+	}
+
+	return validateDCCStatements(dcc, rules, now)
+}
+
+// validateDCCStructure validates the parts of the DCC that don't depend on the rules
+func validateDCCStructure(dcc *hcertcommon.DCC) (err error) {
 	// Validate date of birth
 	err = validateDateOfBirth(dcc.DateOfBirth)
 	if err != nil {
@@ -116,7 +234,10 @@ func validateDCC(dcc *hcertcommon.DCC, rules *europeanVerificationRules, now tim
 		return errors.WrapPrefix(err, "Invalid statement amount", 0)
 	}
 
-	// Validate statements
+	return nil
+}
+
+func validateDCCStatements(dcc *hcertcommon.DCC, rules *europeanVerificationRules, now time.Time) (err error) {
 	for _, vacc := range dcc.Vaccinations {
 		err = validateVaccination(vacc, rules, now)
 		if err != nil {
@@ -144,7 +265,7 @@ func validateDCC(dcc *hcertcommon.DCC, rules *europeanVerificationRules, now tim
 func validateDateOfBirth(dob string) error {
 	_, _, _, err := parseDateOfBirth(dob)
 	if err != nil {
-		return errors.WrapPrefix(err, "Invalid date of birth", 0)
+		return errors.WrapPrefix(withFailureReason(err, FAILURE_REASON_INVALID_DATE_OF_BIRTH), "Invalid date of birth", 0)
 	}
 
 	return nil
@@ -152,7 +273,7 @@ func validateDateOfBirth(dob string) error {
 
 func validateName(name *hcertcommon.DCCName) error {
 	if name.StandardizedFamilyName == "" && name.StandardizedGivenName == "" {
-		return errors.Errorf("Either the standardized family name or given name must be present")
+		return failuref(FAILURE_REASON_INVALID_NAME, "Either the standardized family name or given name must be present")
 	}
 
 	return nil
@@ -165,11 +286,12 @@ func validateStatementAmount(dcc *hcertcommon.DCC) error {
 	totalAmount := vaccAmount + testAmount + recAmount
 
 	if totalAmount == 0 {
-		return errors.Errorf("Contains no vaccination, test or recovery statements")
+		return failuref(FAILURE_REASON_INVALID_STATEMENT_AMOUNT, "Contains no vaccination, test or recovery statements")
 	}
 
 	if totalAmount > 1 {
-		return errors.Errorf(
+		return failuref(
+			FAILURE_REASON_INVALID_STATEMENT_AMOUNT,
 			"Contains too many statements (%d vaccinations, %d tests and %d recoveries)",
 			vaccAmount, testAmount, recAmount,
 		)
@@ -179,98 +301,219 @@ func validateStatementAmount(dcc *hcertcommon.DCC) error {
 }
 
 func validateVaccination(vacc *hcertcommon.DCCVaccination, rules *europeanVerificationRules, now time.Time) error {
+	validFrom, validUntil, err := checkVaccination(vacc, rules)
+	if err != nil {
+		return err
+	}
+
+	nowDate := now.Truncate(24 * time.Hour).UTC()
+	if nowDate.Before(validFrom) {
+		return validityFailuref(FAILURE_REASON_VACCINATION_NOT_YET_VALID, validFrom, validUntil, "Date of vaccination is before the delayed validity date")
+	}
+
+	if !validUntil.IsZero() && validUntil.Before(nowDate) {
+		return validityFailuref(FAILURE_REASON_VACCINATION_EXPIRED, validFrom, validUntil, "Vaccination is not valid anymore without a booster")
+	}
+
+	return nil
+}
+
+// checkVaccination validates the parts of a vaccination that don't depend on the current time,
+// and computes its validity window
+func checkVaccination(vacc *hcertcommon.DCCVaccination, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
 	// Disease agent
 	if !trimmedStringEquals(vacc.DiseaseTargeted, DISEASE_TARGETED_COVID_19) {
-		return errors.Errorf("Disease targeted should be COVID-19")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_DISEASE_NOT_COVID_19, "Disease targeted should be COVID-19")
 	}
 
 	// Allowed vaccine
 	if !containsTrimmedString(rules.VaccineAllowedProducts, vacc.MedicinalProduct) {
-		return errors.Errorf("Medicinal product is not accepted")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_VACCINE_NOT_ALLOWED, "Medicinal product is not accepted")
 	}
 
 	// Dose number and total number of doses
 	if vacc.DoseNumber < vacc.TotalSeriesOfDoses {
-		return errors.Errorf("Dose number is smaller than the specified total amount of doses")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_VACCINATION_INCOMPLETE, "Dose number is smaller than the specified total amount of doses")
 	}
 
-	// Date of vaccination with a configured delay in validity, with a special case for Janssen
+	// Date of vaccination with a configured delay in validity, and an optional maximum validity
+	return vaccinationValidity(vacc, rules)
+}
+
+// vaccinationValidity computes the validity window of a complete vaccination, according to the
+// rules of its medicinal product. The valid until time is zero when the vaccination doesn't expire.
+func vaccinationValidity(vacc *hcertcommon.DCCVaccination, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
 	dov, err := parseDate(vacc.DateOfVaccination)
 	if err != nil {
-		return errors.Errorf("Date of vaccination could not be parsed")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_VACCINATION_INVALID_DATE, "Date of vaccination could not be parsed")
 	}
 
 	validityDelayDays := rules.VaccinationValidityDelayDays
-	if trimmedStringEquals(vacc.MedicinalProduct, VACCINE_MEDICINAL_PRODUCT_JANSSEN) &&
-		!dov.Before(rules.vaccinationJanssenValidityDelayIntoForceDate) {
-		validityDelayDays = rules.VaccinationJanssenValidityDelayDays
+	validityDays := rules.VaccinationValidityDays
+	isBooster := vacc.DoseNumber > vacc.TotalSeriesOfDoses
+
+	productRule := rules.findVaccinationProductRule(vacc.MedicinalProduct)
+	if productRule != nil {
+		if productRule.ValidityDelayDays != nil && !dov.Before(productRule.validityDelayIntoForceDate) {
+			validityDelayDays = *productRule.ValidityDelayDays
+		}
+
+		if productRule.ValidityDays != nil {
+			validityDays = *productRule.ValidityDays
+		}
+
+		if productRule.PrimarySeriesDoses != 0 && vacc.DoseNumber > productRule.PrimarySeriesDoses {
+			isBooster = true
+		}
 	}
 
-	nowDate := now.Truncate(24 * time.Hour).UTC()
-	vaccinationValidFrom := dov.Add(time.Duration(validityDelayDays*24) * time.Hour)
-	if nowDate.Before(vaccinationValidFrom) {
-		return errors.Errorf("Date of vaccination is before the delayed validity date")
+	// Boosters don't expire (yet), and are valid immediately unless configured otherwise
+	if isBooster {
+		boosterValidityDelayDays := 0
+		if productRule != nil {
+			boosterValidityDelayDays = productRule.BoosterValidityDelayDays
+		}
+
+		return dov.AddDate(0, 0, boosterValidityDelayDays), time.Time{}, nil
 	}
 
-	return nil
+	validFrom = dov.AddDate(0, 0, validityDelayDays)
+	if validityDays != 0 {
+		validUntil = dov.AddDate(0, 0, validityDays)
+	}
+
+	return validFrom, validUntil, nil
 }
 
 func validateTest(test *hcertcommon.DCCTest, rules *europeanVerificationRules, now time.Time) error {
+	doc, testExpirationTime, err := checkTest(test, rules)
+	if err != nil {
+		return err
+	}
+
+	if testExpirationTime.Before(now) {
+		return validityFailuref(FAILURE_REASON_TEST_EXPIRED, doc, testExpirationTime, "Time of collection is more than %s ago", testExpirationTime.Sub(doc).String())
+	}
+
+	if now.Before(doc) {
+		return validityFailuref(FAILURE_REASON_TEST_IN_FUTURE, doc, testExpirationTime, "Time of collection is in the future")
+	}
+
+	return nil
+}
+
+// checkTest validates the parts of a test that don't depend on the current time,
+// and computes its validity window
+func checkTest(test *hcertcommon.DCCTest, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
 	// Disease agent
 	if !trimmedStringEquals(test.DiseaseTargeted, DISEASE_TARGETED_COVID_19) {
-		return errors.Errorf("Disease targeted should be COVID-19")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_DISEASE_NOT_COVID_19, "Disease targeted should be COVID-19")
 	}
 
 	// Test type
 	// The current business rules don't specify that we check for specific ma values
 	if !containsTrimmedString(rules.TestAllowedTypes, test.TypeOfTest) {
-		return errors.Errorf("Type is not allowed")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_TEST_TYPE_NOT_ALLOWED, "Type is not allowed")
 	}
 
 	// Test result
 	if !trimmedStringEquals(test.TestResult, TEST_RESULT_NOT_DETECTED) {
-		return errors.Errorf("Result should be negative (not detected)")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_TEST_POSITIVE, "Result should be negative (not detected)")
+	}
+
+	// Test time of collection, with the configured validity
+	validFrom, validUntil, err = testValidity(test, rules)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	// Rapid antigen test device
+	if trimmedStringEquals(test.TypeOfTest, TEST_TYPE_RAPID_ANTIGEN) && len(rules.TestAllowedRATDevices) != 0 {
+		err = validateTestDevice(test.TestNameAndManufacturer, rules.TestAllowedRATDevices, validFrom)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
 	}
 
-	// Test time of collection
+	return validFrom, validUntil, nil
+}
+
+// testValidity computes the validity window of a test, which starts at the time of collection
+func testValidity(test *hcertcommon.DCCTest, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
 	doc, err := time.Parse(time.RFC3339, test.DateTimeOfCollection)
 	if err != nil {
-		return errors.Errorf("Time of collection could not be parsed")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_TEST_INVALID_DATE, "Time of collection could not be parsed")
 	}
 
-	testValidityHours := rules.TestValidityHours
-	testValidityDuration := time.Duration(testValidityHours) * time.Hour
+	testValidityDuration := time.Duration(rules.TestValidityHours) * time.Hour
 
-	testExpirationTime := doc.Add(testValidityDuration)
-	if testExpirationTime.Before(now) {
-		return errors.Errorf("Time of collection is more than %s ago", testValidityDuration.String())
+	return doc, doc.Add(testValidityDuration), nil
+}
+
+func validateTestDevice(manufacturer string, allowedDevices []*allowedTestDevice, doc time.Time) error {
+	trimmedManufacturer := strings.TrimSpace(manufacturer)
+	for _, device := range allowedDevices {
+		if device.Identifier != trimmedManufacturer {
+			continue
+		}
+
+		if !device.validFrom.IsZero() && doc.Before(device.validFrom) {
+			return failuref(FAILURE_REASON_TEST_DEVICE_NOT_ALLOWED, "Device was not yet allowed at the time of collection")
+		}
+
+		// The device is allowed during the whole last day
+		if !device.validUntil.IsZero() && !doc.Before(device.validUntil.Add(24*time.Hour)) {
+			return failuref(FAILURE_REASON_TEST_DEVICE_NOT_ALLOWED, "Device was not allowed anymore at the time of collection")
+		}
+
+		return nil
 	}
 
-	if now.Before(doc) {
-		return errors.Errorf("Time of collection is in the future")
+	return failuref(FAILURE_REASON_TEST_DEVICE_NOT_ALLOWED, "Device is not allowed for rapid antigen tests")
+}
+
+func validateRecovery(rec *hcertcommon.DCCRecovery, rules *europeanVerificationRules, now time.Time) error {
+	validFrom, validUntil, err := checkRecovery(rec, rules)
+	if err != nil {
+		return err
+	}
+
+	if now.Before(validFrom) {
+		return validityFailuref(FAILURE_REASON_RECOVERY_NOT_YET_VALID, validFrom, validUntil, "Recovery is not yet valid")
+	}
+
+	if validUntil.Before(now) {
+		return validityFailuref(FAILURE_REASON_RECOVERY_EXPIRED, validFrom, validUntil, "Recovery is not valid anymore")
 	}
 
 	return nil
 }
 
-func validateRecovery(rec *hcertcommon.DCCRecovery, rules *europeanVerificationRules, now time.Time) error {
+// checkRecovery validates the parts of a recovery that don't depend on the current time,
+// and computes its validity window
+func checkRecovery(rec *hcertcommon.DCCRecovery, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
 	// Disease agent
 	if !trimmedStringEquals(rec.DiseaseTargeted, DISEASE_TARGETED_COVID_19) {
-		return errors.Errorf("Disease targeted should be COVID-19")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_DISEASE_NOT_COVID_19, "Disease targeted should be COVID-19")
 	}
 
+	return recoveryValidity(rec, rules)
+}
+
+// recoveryValidity computes the validity window of a recovery, which is limited by the validity
+// that is specified in the certificate
+func recoveryValidity(rec *hcertcommon.DCCRecovery, rules *europeanVerificationRules) (validFrom, validUntil time.Time, err error) {
 	testDate, err := parseDate(rec.DateOfFirstPositiveTest)
 	if err != nil {
-		return errors.Errorf("Date of first positive test could not be parsed")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_RECOVERY_INVALID_DATE, "Date of first positive test could not be parsed")
 	}
 
-	// Validity
 	// First calculate the validity according to our own rules
 	validFromDays := rules.RecoveryValidFromDays
 	validUntilDays := rules.RecoveryValidUntilDays
 
-	validFrom := testDate.Add(time.Duration(validFromDays*24) * time.Hour)
-	validUntil := testDate.Add(time.Duration(validUntilDays*24) * time.Hour)
+	validFrom = testDate.Add(time.Duration(validFromDays*24) * time.Hour)
+	validUntil = testDate.Add(time.Duration(validUntilDays*24) * time.Hour)
 
 	// If the specified validity is smaller on any side, use that specified validity
 	specifiedValidFrom, err := parseDate(rec.CertificateValidFrom)
@@ -283,20 +526,11 @@ func validateRecovery(rec *hcertcommon.DCCRecovery, rules *europeanVerificationR
 		validUntil = specifiedValidUntil
 	}
 
-	// Actually validate
 	if validUntil.Before(validFrom) {
-		return errors.Errorf("Valid until cannot be before valid from")
-	}
-
-	if now.Before(validFrom) {
-		return errors.Errorf("Recovery is not yet valid")
+		return time.Time{}, time.Time{}, failuref(FAILURE_REASON_RECOVERY_INVALID_VALIDITY, "Valid until cannot be before valid from")
 	}
 
-	if validUntil.Before(now) {
-		return errors.Errorf("Recovery is not valid anymore")
-	}
-
-	return nil
+	return validFrom, validUntil, nil
 }
 
 func buildVerificationDetails(hcert *hcertcommon.HealthCertificate, pk *verifier.AnnotatedEuropeanPk, isSpecimen bool) (*VerificationDetails, error) {
@@ -0,0 +1,138 @@
+package mobilecore
+
+import (
+	"fmt"
+	"github.com/go-errors/errors"
+	"time"
+)
+
+// Failure reasons of a VerificationResult with the VERIFICATION_FAILED_ERROR status.
+// These values are stable, so that the apps can show specific UI for them.
+const (
+	FAILURE_REASON_UNKNOWN         = "UNKNOWN"
+	FAILURE_REASON_NOT_INITIALIZED = "NOT_INITIALIZED"
+	FAILURE_REASON_INTERNAL_ERROR  = "INTERNAL_ERROR"
+
+	FAILURE_REASON_INVALID_PROOF = "INVALID_PROOF"
+	FAILURE_REASON_UNKNOWN_KEY   = "UNKNOWN_KEY"
+	FAILURE_REASON_DENYLISTED    = "DENYLISTED"
+	FAILURE_REASON_REVOKED       = "REVOKED"
+
+	FAILURE_REASON_INVALID_ATTRIBUTES       = "INVALID_ATTRIBUTES"
+	FAILURE_REASON_CREDENTIAL_NOT_YET_VALID = "CREDENTIAL_NOT_YET_VALID"
+	FAILURE_REASON_CREDENTIAL_EXPIRED       = "CREDENTIAL_EXPIRED"
+	FAILURE_REASON_QR_TOO_OLD               = "QR_TOO_OLD"
+
+	FAILURE_REASON_HCERT_INVALID_VALIDITY = "HCERT_INVALID_VALIDITY"
+	FAILURE_REASON_HCERT_NOT_YET_VALID    = "HCERT_NOT_YET_VALID"
+	FAILURE_REASON_HCERT_EXPIRED          = "HCERT_EXPIRED"
+
+	FAILURE_REASON_INVALID_DATE_OF_BIRTH    = "INVALID_DATE_OF_BIRTH"
+	FAILURE_REASON_INVALID_NAME             = "INVALID_NAME"
+	FAILURE_REASON_INVALID_STATEMENT_AMOUNT = "INVALID_STATEMENT_AMOUNT"
+	FAILURE_REASON_DISEASE_NOT_COVID_19     = "DISEASE_NOT_COVID_19"
+
+	FAILURE_REASON_VACCINE_NOT_ALLOWED       = "VACCINE_NOT_ALLOWED"
+	FAILURE_REASON_VACCINATION_INCOMPLETE    = "VACCINATION_INCOMPLETE"
+	FAILURE_REASON_VACCINATION_INVALID_DATE  = "VACCINATION_INVALID_DATE"
+	FAILURE_REASON_VACCINATION_NOT_YET_VALID = "VACCINATION_NOT_YET_VALID"
+	FAILURE_REASON_VACCINATION_EXPIRED       = "VACCINATION_EXPIRED"
+
+	FAILURE_REASON_TEST_TYPE_NOT_ALLOWED   = "TEST_TYPE_NOT_ALLOWED"
+	FAILURE_REASON_TEST_POSITIVE           = "TEST_POSITIVE"
+	FAILURE_REASON_TEST_INVALID_DATE       = "TEST_INVALID_DATE"
+	FAILURE_REASON_TEST_EXPIRED            = "TEST_EXPIRED"
+	FAILURE_REASON_TEST_IN_FUTURE          = "TEST_IN_FUTURE"
+	FAILURE_REASON_TEST_DEVICE_NOT_ALLOWED = "TEST_DEVICE_NOT_ALLOWED"
+
+	FAILURE_REASON_RECOVERY_INVALID_DATE     = "RECOVERY_INVALID_DATE"
+	FAILURE_REASON_RECOVERY_INVALID_VALIDITY = "RECOVERY_INVALID_VALIDITY"
+	FAILURE_REASON_RECOVERY_NOT_YET_VALID    = "RECOVERY_NOT_YET_VALID"
+	FAILURE_REASON_RECOVERY_EXPIRED          = "RECOVERY_EXPIRED"
+
+	FAILURE_REASON_UNKNOWN_POLICY         = "UNKNOWN_POLICY"
+	FAILURE_REASON_NOT_ACCEPTED_BY_POLICY = "NOT_ACCEPTED_BY_POLICY"
+	FAILURE_REASON_UNKNOWN_COUNTRY        = "UNKNOWN_COUNTRY"
+	FAILURE_REASON_NOT_VALID_IN_COUNTRY   = "NOT_VALID_IN_COUNTRY"
+
+	FAILURE_REASON_UNKNOWN_VALUE_SET_CODE = "UNKNOWN_VALUE_SET_CODE"
+	FAILURE_REASON_BUSINESS_RULE_FAILED   = "BUSINESS_RULE_FAILED"
+)
+
+// VerificationFailure describes why a verification failed. The validity window is only
+// present (as unix timestamps) for failures that are caused by it, and is zero otherwise.
+type VerificationFailure struct {
+	Reason     string `json:"reason"`
+	ValidFrom  int64  `json:"validFrom"`
+	ValidUntil int64  `json:"validUntil"`
+}
+
+// failureError carries the failure reason through the (prefix) wrapped error chain
+type failureError struct {
+	failure *VerificationFailure
+	message string
+}
+
+func (fe *failureError) Error() string {
+	return fe.message
+}
+
+func failuref(reason string, format string, a ...interface{}) *errors.Error {
+	return errors.Wrap(&failureError{
+		failure: &VerificationFailure{Reason: reason},
+		message: fmt.Sprintf(format, a...),
+	}, 1)
+}
+
+func validityFailuref(reason string, validFrom, validUntil time.Time, format string, a ...interface{}) *errors.Error {
+	failure := &VerificationFailure{Reason: reason}
+	if !validFrom.IsZero() {
+		failure.ValidFrom = validFrom.Unix()
+	}
+
+	if !validUntil.IsZero() {
+		failure.ValidUntil = validUntil.Unix()
+	}
+
+	return errors.Wrap(&failureError{
+		failure: failure,
+		message: fmt.Sprintf(format, a...),
+	}, 1)
+}
+
+// withFailureReason attaches a failure reason to an error that doesn't have one yet
+func withFailureReason(err error, reason string) error {
+	var fe *failureError
+	if errors.As(err, &fe) {
+		return err
+	}
+
+	return errors.Wrap(&failureError{
+		failure: &VerificationFailure{Reason: reason},
+		message: err.Error(),
+	}, 1)
+}
+
+func getVerificationFailure(err error) *VerificationFailure {
+	var fe *failureError
+	if errors.As(err, &fe) {
+		return fe.failure
+	}
+
+	return &VerificationFailure{Reason: FAILURE_REASON_UNKNOWN}
+}
+
+// recoverVerificationResult turns an unexpected panic into an error result, as a panic
+// would otherwise crash the app across the gomobile boundary
+func recoverVerificationResult(result **VerificationResult) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	*result = &VerificationResult{
+		Status:  VERIFICATION_FAILED_ERROR,
+		Error:   fmt.Sprintf("Unexpected error during verification: %v", r),
+		Failure: &VerificationFailure{Reason: FAILURE_REASON_INTERNAL_ERROR},
+	}
+}
@@ -0,0 +1,138 @@
+package mobilecore
+
+import (
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+)
+
+const (
+	STATEMENT_TYPE_VACCINATION = "vaccination"
+	STATEMENT_TYPE_RECOVERY    = "recovery"
+	STATEMENT_TYPE_TEST        = "test"
+
+	// The policy that is used when none is given, and the only policy when the config defines none
+	DEFAULT_VERIFICATION_POLICY = "3G"
+)
+
+// verificationPolicy determines which kinds of proof are accepted by a single scan
+type verificationPolicy struct {
+	Identifier             string   `json:"id"`
+	AcceptedStatementTypes []string `json:"acceptedStatementTypes"`
+
+	// The categories of domestic credentials that are accepted, in which an empty string stands
+	// for credentials without category. Without categories, all domestic credentials are accepted,
+	// which is only allowed for policies that accept every statement type.
+	DomesticCategories []string `json:"domesticCategories"`
+}
+
+var defaultVerificationPolicies = []*verificationPolicy{
+	{
+		Identifier:             DEFAULT_VERIFICATION_POLICY,
+		AcceptedStatementTypes: []string{STATEMENT_TYPE_VACCINATION, STATEMENT_TYPE_RECOVERY, STATEMENT_TYPE_TEST},
+	},
+}
+
+// findVerificationPolicy returns the policy with the given identifier, or the default policy
+// of the config when the identifier is empty
+func (config *verifierConfiguration) findVerificationPolicy(policyId string) (*verificationPolicy, error) {
+	if policyId == "" {
+		policyId = config.DefaultVerificationPolicy
+	}
+
+	for _, policy := range config.VerificationPolicies {
+		if policy.Identifier == policyId {
+			return policy, nil
+		}
+	}
+
+	return nil, failuref(FAILURE_REASON_UNKNOWN_POLICY, "Verification policy '%s' is not part of the config", policyId)
+}
+
+func (policy *verificationPolicy) checkDomesticCategory(category string) error {
+	if policy.DomesticCategories == nil {
+		return nil
+	}
+
+	for _, acceptedCategory := range policy.DomesticCategories {
+		if acceptedCategory == category {
+			return nil
+		}
+	}
+
+	return failuref(FAILURE_REASON_NOT_ACCEPTED_BY_POLICY, "Credential category '%s' is not accepted by policy %s", category, policy.Identifier)
+}
+
+func (policy *verificationPolicy) checkStatementType(dcc *hcertcommon.DCC) error {
+	statementType := getStatementType(dcc)
+	for _, acceptedStatementType := range policy.AcceptedStatementTypes {
+		if acceptedStatementType == statementType {
+			return nil
+		}
+	}
+
+	return failuref(FAILURE_REASON_NOT_ACCEPTED_BY_POLICY, "A %s statement is not accepted by policy %s", statementType, policy.Identifier)
+}
+
+// getStatementType returns the type of the single statement of a validated DCC
+func getStatementType(dcc *hcertcommon.DCC) string {
+	if len(dcc.Vaccinations) != 0 {
+		return STATEMENT_TYPE_VACCINATION
+	}
+
+	if len(dcc.Recoveries) != 0 {
+		return STATEMENT_TYPE_RECOVERY
+	}
+
+	return STATEMENT_TYPE_TEST
+}
+
+func validateVerificationPolicies(config *verifierConfiguration, addIssue func(field string, format string, a ...interface{})) {
+	policyIds := map[string]bool{}
+	for _, policy := range config.VerificationPolicies {
+		if policy == nil || policy.Identifier == "" {
+			addIssue("verificationPolicies", "Should not contain a policy without identifier")
+			continue
+		}
+
+		if policyIds[policy.Identifier] {
+			addIssue("verificationPolicies", "Policy %s is present more than once", policy.Identifier)
+		}
+
+		policyIds[policy.Identifier] = true
+
+		if len(policy.AcceptedStatementTypes) == 0 {
+			addIssue("verificationPolicies", "Policy %s should accept at least one statement type", policy.Identifier)
+		}
+
+		acceptedStatementTypes := map[string]bool{}
+		for _, statementType := range policy.AcceptedStatementTypes {
+			switch statementType {
+			case STATEMENT_TYPE_VACCINATION, STATEMENT_TYPE_RECOVERY, STATEMENT_TYPE_TEST:
+				acceptedStatementTypes[statementType] = true
+			default:
+				addIssue("verificationPolicies", "Policy %s has unknown statement type '%s'", policy.Identifier, statementType)
+			}
+		}
+
+		// Otherwise a restrictive policy would accept any domestic credential
+		if policy.DomesticCategories == nil && len(acceptedStatementTypes) != 3 {
+			addIssue("verificationPolicies", "Policy %s should list its accepted domestic categories, as it doesn't accept every statement type", policy.Identifier)
+		}
+	}
+
+	// The default policy should be part of the policies that are used, which are the
+	// default policies when the config doesn't define any
+	if len(config.VerificationPolicies) == 0 {
+		for _, policy := range defaultVerificationPolicies {
+			policyIds[policy.Identifier] = true
+		}
+	}
+
+	defaultPolicyId := config.DefaultVerificationPolicy
+	if defaultPolicyId == "" {
+		defaultPolicyId = DEFAULT_VERIFICATION_POLICY
+	}
+
+	if !policyIds[defaultPolicyId] {
+		addIssue("defaultVerificationPolicy", "Policy %s is not part of the verification policies", defaultPolicyId)
+	}
+}
@@ -0,0 +1,136 @@
+package mobilecore
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerificationPolicies(t *testing.T) {
+	now := time.Unix(1627462000, 0)
+
+	configJson, err := os.ReadFile("./testdata/config.json")
+	if err != nil {
+		t.Fatal("Could not read config", err)
+	}
+
+	pksConfig, err := NewPublicKeysConfig("./testdata/public_keys.json", true)
+	if err != nil {
+		t.Fatal("Could not load public keys config", err)
+	}
+
+	policiesJson := `"verificationPolicies": [
+		{"id": "3G", "acceptedStatementTypes": ["vaccination", "recovery", "test"]},
+		{"id": "2G", "acceptedStatementTypes": ["vaccination", "recovery"], "domesticCategories": ["2"]},
+		{"id": "1G", "acceptedStatementTypes": ["test"], "domesticCategories": ["1"]}
+	],
+	"defaultVerificationPolicy": "2G",
+	"configTTL": 86400,`
+	policiesConfigJson := []byte(strings.Replace(string(configJson), `"configTTL": 86400,`, policiesJson, 1))
+
+	v, err := NewVerifier(policiesConfigJson, pksConfig, time.Now())
+	if err != nil {
+		t.Fatal("Could not create verifier", err)
+	}
+
+	// The default QR contains a vaccination
+	testCases := []struct {
+		policy string
+		reason string
+	}{
+		{"", ""},
+		{"3G", ""},
+		{"2G", ""},
+		{"1G", FAILURE_REASON_NOT_ACCEPTED_BY_POLICY},
+		{"0G", FAILURE_REASON_UNKNOWN_POLICY},
+	}
+
+	for i, testCase := range testCases {
+		r := v.verifyWithOptions(defaultQR, &verificationOptions{policyId: testCase.policy}, now)
+		if testCase.reason == "" {
+			if r.Status != VERIFICATION_SUCCESS {
+				t.Fatal("Expected success for test case", i, r.Error)
+			}
+
+			expectedPolicy := testCase.policy
+			if expectedPolicy == "" {
+				expectedPolicy = "2G"
+			}
+
+			if r.Details.VerificationPolicy != expectedPolicy {
+				t.Fatal("Expected policy", expectedPolicy, "in the details of test case", i)
+			}
+		} else if r.Status != VERIFICATION_FAILED_ERROR || r.Failure.Reason != testCase.reason {
+			t.Fatal("Expected reason", testCase.reason, "for test case", i, r.Error)
+		}
+	}
+
+	// Domestic credentials without category are only accepted by policies without categories
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key", r1.Error)
+	}
+
+	credsJson := issueTestCredentials(t, r1.Value, buildCredentialsAttributes(1))
+	r2 := Disclose(r1.Value, credsJson[0])
+	if r2.Error != "" {
+		t.Fatal("Could not disclose credential", r2.Error)
+	}
+
+	r3 := v.VerifyWithPolicy(r2.Value, "3G")
+	if r3.Status != VERIFICATION_SUCCESS || r3.Details.VerificationPolicy != "3G" {
+		t.Fatal("Expected an uncategorized credential to be accepted by 3G", r3.Error)
+	}
+
+	r4 := v.VerifyWithPolicy(r2.Value, "2G")
+	if r4.Status != VERIFICATION_FAILED_ERROR || r4.Failure.Reason != FAILURE_REASON_NOT_ACCEPTED_BY_POLICY {
+		t.Fatal("Expected an uncategorized credential not to be accepted by 2G", r4.Error)
+	}
+
+	policy, err := v.getSnapshot().config.findVerificationPolicy("2G")
+	if err != nil || policy.checkDomesticCategory("2") != nil || policy.checkDomesticCategory("1") == nil {
+		t.Fatal("Expected only category 2 to be accepted by 2G")
+	}
+
+	// Without policies in the config, only the default policy is available
+	r5 := VerifyWithPolicy(defaultQR, "2G")
+	if r5.Failure == nil || r5.Failure.Reason != FAILURE_REASON_UNKNOWN_POLICY {
+		t.Fatal("Expected an unknown policy for the testdata config")
+	}
+
+	// Invalid policies are reported
+	invalidPoliciesJson := `"verificationPolicies": [
+		{"id": "", "acceptedStatementTypes": ["vaccination"]},
+		{"id": "2G", "acceptedStatementTypes": []},
+		{"id": "2G", "acceptedStatementTypes": ["booster"]}
+	],
+	"configTTL": 86400,`
+	invalidConfig := mustUnmarshalVerifierConfig(t, []byte(strings.Replace(string(configJson), `"configTTL": 86400,`, invalidPoliciesJson, 1)))
+
+	issues := validateVerifierConfig(invalidConfig)
+	if len(issues) != 7 {
+		t.Fatal("Expected 7 policy issues, got", len(issues))
+	}
+
+	// A restrictive policy without domestic categories would accept any domestic credential
+	uncategorizedPoliciesJson := `"verificationPolicies": [
+		{"id": "3G", "acceptedStatementTypes": ["vaccination", "recovery", "test"]},
+		{"id": "2G", "acceptedStatementTypes": ["vaccination", "recovery"]}
+	],
+	"configTTL": 86400,`
+	uncategorizedConfig := mustUnmarshalVerifierConfig(t, []byte(strings.Replace(string(configJson), `"configTTL": 86400,`, uncategorizedPoliciesJson, 1)))
+
+	issues = validateVerifierConfig(uncategorizedConfig)
+	if len(issues) != 1 || issues[0].Field != "verificationPolicies" {
+		t.Fatal("Expected a single issue for a restrictive policy without domestic categories")
+	}
+
+	// Without policies in the config, the default policy should be the built-in one
+	unknownDefaultConfig := mustUnmarshalVerifierConfig(t, []byte(strings.Replace(string(configJson), `"configTTL": 86400,`, `"defaultVerificationPolicy": "2G", "configTTL": 86400,`, 1)))
+
+	issues = validateVerifierConfig(unknownDefaultConfig)
+	if len(issues) != 1 || issues[0].Field != "defaultVerificationPolicy" {
+		t.Fatal("Expected a single issue for an unknown default policy without policies")
+	}
+}
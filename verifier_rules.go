@@ -0,0 +1,397 @@
+package mobilecore
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-errors/errors"
+	hcertcommon "github.com/minvws/nl-covid19-coronacheck-hcert/common"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BUSINESS_RULE_ENGINE_CERTLOGIC = "CERTLOGIC"
+
+	BUSINESS_RULE_CERTIFICATE_TYPE_GENERAL     = "General"
+	BUSINESS_RULE_CERTIFICATE_TYPE_VACCINATION = "Vaccination"
+	BUSINESS_RULE_CERTIFICATE_TYPE_TEST        = "Test"
+	BUSINESS_RULE_CERTIFICATE_TYPE_RECOVERY    = "Recovery"
+
+	// An open result means that the rule could not be evaluated, which is not a pass
+	BUSINESS_RULE_RESULT_PASSED = "PASSED"
+	BUSINESS_RULE_RESULT_FAILED = "FAILED"
+	BUSINESS_RULE_RESULT_OPEN   = "OPEN"
+
+	// The identifiers of the built-in Go rules, which are used when no business rules are configured
+	GO_RULE_VACCINATION = "GO-VR-0001"
+	GO_RULE_TEST        = "GO-TR-0001"
+	GO_RULE_RECOVERY    = "GO-RR-0001"
+
+	// The identifiers of the failed results for statements to which no business rule applies
+	MISSING_RULE_VACCINATION = "MISSING-VR"
+	MISSING_RULE_TEST        = "MISSING-TR"
+	MISSING_RULE_RECOVERY    = "MISSING-RR"
+
+	DEFAULT_COUNTRY_OF_ARRIVAL = "NL"
+)
+
+// BusinessRule is a CertLogic business rule, in the format in which the EU gateway distributes them
+type BusinessRule struct {
+	Identifier      string                     `json:"Identifier"`
+	Type            string                     `json:"Type"`
+	Country         string                     `json:"Country"`
+	Version         string                     `json:"Version"`
+	SchemaVersion   string                     `json:"SchemaVersion"`
+	Engine          string                     `json:"Engine"`
+	EngineVersion   string                     `json:"EngineVersion"`
+	CertificateType string                     `json:"CertificateType"`
+	Description     []*BusinessRuleDescription `json:"Description"`
+	ValidFrom       string                     `json:"ValidFrom"`
+	ValidTo         string                     `json:"ValidTo"`
+	AffectedFields  []string                   `json:"AffectedFields"`
+	Logic           interface{}                `json:"Logic"`
+}
+
+type BusinessRuleDescription struct {
+	Language string `json:"lang"`
+	Desc     string `json:"desc"`
+}
+
+// BusinessRuleResult is the outcome of a single rule. The message is the (English) description
+// of a failed rule, or the reason why the rule could not be evaluated.
+type BusinessRuleResult struct {
+	Identifier string `json:"identifier"`
+	Result     string `json:"result"`
+	Message    string `json:"message"`
+}
+
+// EvaluateEuropeanRules reports per rule whether the DCC in a European QR code passes the rules
+// of the country of arrival, using the default verifier. The value of the result is a JSON list
+// of rule results. The signature of the QR code is verified, but the denylist is not checked.
+func EvaluateEuropeanRules(proofQREncoded []byte, countryOfArrival string) (result *Result) {
+	defer recoverResult(&result)
+
+	ruleResults, err := defaultVerifier.EvaluateEuropeanRules(proofQREncoded, countryOfArrival, time.Now())
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	ruleResultsJson, err := json.Marshal(ruleResults)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not marshal rule results")
+	}
+
+	return &Result{ruleResultsJson, "", ""}
+}
+
+func (v *Verifier) EvaluateEuropeanRules(proofQREncoded []byte, countryOfArrival string, now time.Time) ([]*BusinessRuleResult, error) {
+	var snapshot *verifierSnapshot
+	if v != nil {
+		snapshot = v.getSnapshot()
+	}
+
+	if snapshot == nil {
+		return nil, codedErrorf(ERROR_CODE_NOT_INITIALIZED, "The verifier has not been initialized")
+	}
+
+	verified, err := snapshot.europeanVerifier.VerifyQREncoded(proofQREncoded)
+	if err != nil {
+		return nil, errors.WrapPrefix(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not verify european QR code", 0)
+	}
+
+	arrival, err := snapshot.config.findEuropeanRules(countryOfArrival)
+	if err != nil {
+		return nil, withErrorCode(err, ERROR_CODE_MALFORMED_INPUT)
+	}
+
+	return evaluateEuropeanRules(verified.HealthCertificate, arrival.rules, snapshot.valueSets, arrival.countryCode, now), nil
+}
+
+// evaluateEuropeanRules evaluates the configured business rules, or the built-in Go rules
+// for every statement when no business rules are configured
+func evaluateEuropeanRules(hcert *hcertcommon.HealthCertificate, rules *europeanVerificationRules, valueSets ValueSetsLookup, countryOfArrival string, now time.Time) []*BusinessRuleResult {
+	if len(rules.BusinessRules) == 0 {
+		return evaluateGoRules(hcert.DCC, rules, now)
+	}
+
+	return evaluateBusinessRules(hcert, rules, valueSets, countryOfArrival, now)
+}
+
+// validateDCCWithBusinessRules validates the structure of the DCC like validateDCC does,
+// but validates the statements against the configured business rules
+func validateDCCWithBusinessRules(hcert *hcertcommon.HealthCertificate, rules *europeanVerificationRules, valueSets ValueSetsLookup, countryOfArrival string, now time.Time) error {
+	err := validateDCCStructure(hcert.DCC)
+	if err != nil {
+		return err
+	}
+
+	var failedIdentifiers []string
+	for _, ruleResult := range evaluateBusinessRules(hcert, rules, valueSets, countryOfArrival, now) {
+		if ruleResult.Result != BUSINESS_RULE_RESULT_PASSED {
+			failedIdentifiers = append(failedIdentifiers, ruleResult.Identifier)
+		}
+	}
+
+	if len(failedIdentifiers) != 0 {
+		return failuref(FAILURE_REASON_BUSINESS_RULE_FAILED, "Did not pass business rule(s) %s", strings.Join(failedIdentifiers, ", "))
+	}
+
+	return nil
+}
+
+func evaluateGoRules(dcc *hcertcommon.DCC, rules *europeanVerificationRules, now time.Time) []*BusinessRuleResult {
+	ruleResults := make([]*BusinessRuleResult, 0)
+	addRuleResult := func(identifier string, err error) {
+		ruleResult := &BusinessRuleResult{Identifier: identifier, Result: BUSINESS_RULE_RESULT_PASSED}
+		if err != nil {
+			ruleResult.Result = BUSINESS_RULE_RESULT_FAILED
+			ruleResult.Message = err.Error()
+		}
+
+		ruleResults = append(ruleResults, ruleResult)
+	}
+
+	for _, vacc := range dcc.Vaccinations {
+		addRuleResult(GO_RULE_VACCINATION, validateVaccination(vacc, rules, now))
+	}
+
+	for _, test := range dcc.Tests {
+		addRuleResult(GO_RULE_TEST, validateTest(test, rules, now))
+	}
+
+	for _, rec := range dcc.Recoveries {
+		addRuleResult(GO_RULE_RECOVERY, validateRecovery(rec, rules, now))
+	}
+
+	return ruleResults
+}
+
+// evaluateBusinessRules evaluates the newest version of every applicable business rule. A statement
+// to which no rule of its certificate type applies fails, as it would otherwise pass unchecked.
+func evaluateBusinessRules(hcert *hcertcommon.HealthCertificate, rules *europeanVerificationRules, valueSets ValueSetsLookup, countryOfArrival string, now time.Time) []*BusinessRuleResult {
+	ruleResults := make([]*BusinessRuleResult, 0)
+	applicableRules := findApplicableBusinessRules(rules.BusinessRules, hcert.DCC, countryOfArrival, now)
+
+	coveredCertificateTypes := map[string]bool{}
+	for _, rule := range applicableRules {
+		coveredCertificateTypes[rule.CertificateType] = true
+	}
+
+	missingRules := []struct {
+		certificateType string
+		present         bool
+		identifier      string
+	}{
+		{BUSINESS_RULE_CERTIFICATE_TYPE_VACCINATION, len(hcert.DCC.Vaccinations) != 0, MISSING_RULE_VACCINATION},
+		{BUSINESS_RULE_CERTIFICATE_TYPE_TEST, len(hcert.DCC.Tests) != 0, MISSING_RULE_TEST},
+		{BUSINESS_RULE_CERTIFICATE_TYPE_RECOVERY, len(hcert.DCC.Recoveries) != 0, MISSING_RULE_RECOVERY},
+	}
+
+	for _, missingRule := range missingRules {
+		if missingRule.present && !coveredCertificateTypes[missingRule.certificateType] {
+			message := fmt.Sprintf("No business rule applies to the %s certificate type", missingRule.certificateType)
+			ruleResults = append(ruleResults, &BusinessRuleResult{missingRule.identifier, BUSINESS_RULE_RESULT_FAILED, message})
+		}
+	}
+
+	data, err := buildCertLogicData(hcert, rules, valueSets, countryOfArrival, now)
+	if err != nil {
+		// Without data, none of the rules can be evaluated
+		for _, rule := range applicableRules {
+			ruleResults = append(ruleResults, &BusinessRuleResult{rule.Identifier, BUSINESS_RULE_RESULT_OPEN, err.Error()})
+		}
+
+		return ruleResults
+	}
+
+	for _, rule := range applicableRules {
+		value, err := evaluateCertLogic(rule.Logic, data)
+		if err != nil {
+			ruleResults = append(ruleResults, &BusinessRuleResult{rule.Identifier, BUSINESS_RULE_RESULT_OPEN, err.Error()})
+		} else if !isCertLogicTruthy(value) {
+			ruleResults = append(ruleResults, &BusinessRuleResult{rule.Identifier, BUSINESS_RULE_RESULT_FAILED, rule.englishDescription()})
+		} else {
+			ruleResults = append(ruleResults, &BusinessRuleResult{rule.Identifier, BUSINESS_RULE_RESULT_PASSED, ""})
+		}
+	}
+
+	return ruleResults
+}
+
+// buildCertLogicData builds the data object against which the rules are evaluated, with the DCC
+// as payload in its JSON form, and the external parameters of the validation. The value sets
+// of the config take precedence over the loaded EU value sets with the same identifier.
+func buildCertLogicData(hcert *hcertcommon.HealthCertificate, rules *europeanVerificationRules, valueSets ValueSetsLookup, countryOfArrival string, now time.Time) (interface{}, error) {
+	dccJson, err := json.Marshal(hcert.DCC)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON marshal DCC", 0)
+	}
+
+	var payload interface{}
+	err = json.Unmarshal(dccJson, &payload)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not JSON unmarshal DCC", 0)
+	}
+
+	codesPerValueSet := valueSets.certLogicValueSets()
+	for valueSetId, codes := range rules.BusinessRuleValueSets {
+		codesPerValueSet[valueSetId] = codes
+	}
+
+	certLogicValueSets := map[string]interface{}{}
+	for valueSetId, codes := range codesPerValueSet {
+		valueSet := make([]interface{}, 0, len(codes))
+		for _, code := range codes {
+			valueSet = append(valueSet, code)
+		}
+
+		certLogicValueSets[valueSetId] = valueSet
+	}
+
+	return map[string]interface{}{
+		"payload": payload,
+		"external": map[string]interface{}{
+			"validationClock": now.UTC().Format(time.RFC3339),
+			"valueSets":       certLogicValueSets,
+			"countryCode":     countryOfArrival,
+			"exp":             time.Unix(hcert.ExpirationTime, 0).UTC().Format(time.RFC3339),
+			"iat":             time.Unix(hcert.IssuedAt, 0).UTC().Format(time.RFC3339),
+		},
+	}, nil
+}
+
+// findApplicableBusinessRules returns the applicable rules in configured order, of which only the
+// newest version is kept when multiple versions of a rule apply
+func findApplicableBusinessRules(businessRules []*BusinessRule, dcc *hcertcommon.DCC, countryOfArrival string, now time.Time) []*BusinessRule {
+	var applicableRules []*BusinessRule
+	newestVersionIndices := map[string]int{}
+	for _, rule := range businessRules {
+		if !isBusinessRuleApplicable(rule, dcc, countryOfArrival, now) {
+			continue
+		}
+
+		i, ok := newestVersionIndices[rule.Identifier]
+		if !ok {
+			newestVersionIndices[rule.Identifier] = len(applicableRules)
+			applicableRules = append(applicableRules, rule)
+		} else if compareBusinessRuleVersions(rule.Version, applicableRules[i].Version) > 0 {
+			applicableRules[i] = rule
+		}
+	}
+
+	return applicableRules
+}
+
+// compareBusinessRuleVersions compares two semantic versions, which are known to be valid
+func compareBusinessRuleVersions(a, b string) int {
+	aParts, _ := parseBusinessRuleVersion(a)
+	bParts, _ := parseBusinessRuleVersion(b)
+	for i := range aParts {
+		if aParts[i] != bParts[i] {
+			if aParts[i] < bParts[i] {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
+
+func parseBusinessRuleVersion(version string) ([3]int, error) {
+	var parts [3]int
+	versionParts := strings.Split(version, ".")
+	if len(versionParts) != len(parts) {
+		return parts, errors.Errorf("Version '%s' should consist of three parts", version)
+	}
+
+	for i, versionPart := range versionParts {
+		part, err := strconv.Atoi(versionPart)
+		if err != nil || part < 0 {
+			return parts, errors.Errorf("Version '%s' should consist of non-negative numbers", version)
+		}
+
+		parts[i] = part
+	}
+
+	return parts, nil
+}
+
+func isBusinessRuleApplicable(rule *BusinessRule, dcc *hcertcommon.DCC, countryOfArrival string, now time.Time) bool {
+	if rule.Country != "" && countryOfArrival != "" && rule.Country != countryOfArrival {
+		return false
+	}
+
+	// The validity has been checked when the config was loaded
+	validFrom, _ := time.Parse(time.RFC3339, rule.ValidFrom)
+	validTo, _ := time.Parse(time.RFC3339, rule.ValidTo)
+	if now.Before(validFrom) || !now.Before(validTo) {
+		return false
+	}
+
+	switch rule.CertificateType {
+	case BUSINESS_RULE_CERTIFICATE_TYPE_VACCINATION:
+		return len(dcc.Vaccinations) != 0
+	case BUSINESS_RULE_CERTIFICATE_TYPE_TEST:
+		return len(dcc.Tests) != 0
+	case BUSINESS_RULE_CERTIFICATE_TYPE_RECOVERY:
+		return len(dcc.Recoveries) != 0
+	}
+
+	return true
+}
+
+func (rule *BusinessRule) englishDescription() string {
+	for _, description := range rule.Description {
+		if description.Language == "en" {
+			return description.Desc
+		}
+	}
+
+	return ""
+}
+
+func validateBusinessRules(field string, businessRules []*BusinessRule, addIssue func(field string, format string, a ...interface{})) {
+	for _, rule := range businessRules {
+		if rule == nil {
+			addIssue(field, "Should not contain null rules")
+			continue
+		}
+
+		if rule.Identifier == "" {
+			addIssue(field, "Should not contain a rule without identifier")
+		}
+
+		if rule.Engine != BUSINESS_RULE_ENGINE_CERTLOGIC {
+			addIssue(field, "Rule %s has unsupported engine '%s'", rule.Identifier, rule.Engine)
+		}
+
+		switch rule.CertificateType {
+		case BUSINESS_RULE_CERTIFICATE_TYPE_GENERAL, BUSINESS_RULE_CERTIFICATE_TYPE_VACCINATION,
+			BUSINESS_RULE_CERTIFICATE_TYPE_TEST, BUSINESS_RULE_CERTIFICATE_TYPE_RECOVERY:
+		default:
+			addIssue(field, "Rule %s has unsupported certificate type '%s'", rule.Identifier, rule.CertificateType)
+		}
+
+		_, err := parseBusinessRuleVersion(rule.Version)
+		if err != nil {
+			addIssue(field, "Rule %s has unparseable version '%s'", rule.Identifier, rule.Version)
+		}
+
+		_, err = time.Parse(time.RFC3339, rule.ValidFrom)
+		if err != nil {
+			addIssue(field, "Rule %s has unparseable validFrom '%s'", rule.Identifier, rule.ValidFrom)
+		}
+
+		_, err = time.Parse(time.RFC3339, rule.ValidTo)
+		if err != nil {
+			addIssue(field, "Rule %s has unparseable validTo '%s'", rule.Identifier, rule.ValidTo)
+		}
+
+		if rule.Logic == nil {
+			addIssue(field, "Rule %s has no logic", rule.Identifier)
+		}
+	}
+}
@@ -0,0 +1,474 @@
+package mobilecore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/go-errors/errors"
+	hcertholder "github.com/minvws/nl-covid19-coronacheck-hcert/holder"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+)
+
+const (
+	WALLET_FILENAME       = "wallet.json"
+	WALLET_FORMAT_VERSION = 1
+	WALLET_KEY_SIZE       = 32
+
+	WALLET_CREDENTIAL_TYPE_DOMESTIC = "domestic"
+	WALLET_CREDENTIAL_TYPE_EUROPEAN = "european"
+)
+
+// Wallet stores the holder secret key together with domestic and European credentials, in a single
+// file that is encrypted with AES-256-GCM under a key that is supplied by the platform keystore.
+// It is safe for concurrent use, and every change is persisted before it returns.
+type Wallet struct {
+	lock sync.Mutex
+
+	filePath             string
+	aead                 cipher.AEAD
+	maxStoredCredentials int
+	contents             *walletContents
+
+	europeanHolder *hcertholder.Holder
+}
+
+// walletFile is the versioned on-disk format, of which only the version is readable without the key
+type walletFile struct {
+	Version    int    `json:"version"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type walletContents struct {
+	HolderSk    json.RawMessage     `json:"holderSk"`
+	Credentials []*WalletCredential `json:"credentials"`
+}
+
+// WalletCredential is a stored domestic credential (as JSON) or European credential (as QR string).
+// The valid until is a unix timestamp, which is zero for credentials that don't expire.
+type WalletCredential struct {
+	Identifier string          `json:"identifier"`
+	Type       string          `json:"type"`
+	Credential json.RawMessage `json:"credential,omitempty"`
+	QR         string          `json:"qr,omitempty"`
+	ValidUntil int64           `json:"validUntil"`
+}
+
+// The default wallet instance, as used by the mobile apps through OpenWallet
+var defaultWallet *Wallet
+var defaultWalletLock sync.RWMutex
+
+// OpenWallet opens the wallet in the given directory with the key from the platform keystore,
+// or creates an empty wallet if there is none yet. When the default holder has been initialized,
+// its maximum number of stored credentials is enforced.
+func OpenWallet(walletDirectoryPath string, key []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	maxStoredCredentials := 0
+	if defaultHolder != nil {
+		maxStoredCredentials = defaultHolder.config.MaxStoredCredentials
+	}
+
+	wallet, err := NewWallet(walletDirectoryPath, key, maxStoredCredentials)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not open wallet")
+	}
+
+	defaultWalletLock.Lock()
+	defaultWallet = wallet
+	defaultWalletLock.Unlock()
+
+	return &Result{nil, "", ""}
+}
+
+func getDefaultWallet() *Wallet {
+	defaultWalletLock.RLock()
+	defer defaultWalletLock.RUnlock()
+
+	return defaultWallet
+}
+
+// NewWallet opens or creates the wallet file in the given directory, of which zero maximum
+// stored credentials means unlimited
+func NewWallet(walletDirectoryPath string, key []byte, maxStoredCredentials int) (*Wallet, error) {
+	if len(key) != WALLET_KEY_SIZE {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "The wallet key should be %d bytes, but is %d bytes", WALLET_KEY_SIZE, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not create wallet cipher", 0)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not create wallet cipher", 0)
+	}
+
+	w := &Wallet{
+		filePath:             path.Join(walletDirectoryPath, WALLET_FILENAME),
+		aead:                 aead,
+		maxStoredCredentials: maxStoredCredentials,
+		europeanHolder:       hcertholder.New(),
+	}
+
+	w.contents, err = w.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *Wallet) read() (*walletContents, error) {
+	fileJson, err := os.ReadFile(w.filePath)
+	if os.IsNotExist(err) {
+		return &walletContents{Credentials: []*WalletCredential{}}, nil
+	}
+
+	if err != nil {
+		return nil, errors.WrapPrefix(err, "Could not read wallet file", 0)
+	}
+
+	var file *walletFile
+	err = json.Unmarshal(fileJson, &file)
+	if err != nil || file == nil {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "Could not JSON unmarshal wallet file")
+	}
+
+	// Older formats should be migrated here, when there are any
+	if file.Version != WALLET_FORMAT_VERSION {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "Unsupported wallet format version %d", file.Version)
+	}
+
+	contentsJson, err := w.aead.Open(nil, file.Nonce, file.Ciphertext, walletAdditionalData(file.Version))
+	if err != nil {
+		return nil, codedErrorf(ERROR_CODE_DECRYPTION_FAILED, "Could not decrypt wallet, which may have been encrypted with another key")
+	}
+
+	var contents *walletContents
+	err = json.Unmarshal(contentsJson, &contents)
+	if err != nil || contents == nil {
+		return nil, codedErrorf(ERROR_CODE_MALFORMED_INPUT, "Could not JSON unmarshal wallet contents")
+	}
+
+	if contents.Credentials == nil {
+		contents.Credentials = []*WalletCredential{}
+	}
+
+	return contents, nil
+}
+
+// write persists the given contents, and only replaces the current contents when that succeeded
+func (w *Wallet) write(contents *walletContents) error {
+	contentsJson, err := json.Marshal(contents)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not JSON marshal wallet contents", 0)
+	}
+
+	nonce := make([]byte, w.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not generate wallet nonce", 0)
+	}
+
+	fileJson, err := json.Marshal(&walletFile{
+		Version:    WALLET_FORMAT_VERSION,
+		Nonce:      nonce,
+		Ciphertext: w.aead.Seal(nil, nonce, contentsJson, walletAdditionalData(WALLET_FORMAT_VERSION)),
+	})
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not JSON marshal wallet file", 0)
+	}
+
+	// Write to a temporary file first, so that a crash never leaves a partially written wallet
+	tmpFilePath := w.filePath + ".tmp"
+	err = os.WriteFile(tmpFilePath, fileJson, 0600)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not write wallet file", 0)
+	}
+
+	err = os.Rename(tmpFilePath, w.filePath)
+	if err != nil {
+		return errors.WrapPrefix(err, "Could not replace wallet file", 0)
+	}
+
+	w.contents = contents
+
+	return nil
+}
+
+// walletAdditionalData binds the ciphertext to the format version, so that it can't be changed
+func walletAdditionalData(version int) []byte {
+	return []byte("mobilecore-wallet-v" + strconv.Itoa(version))
+}
+
+// update persists a modified copy of the contents, so that the contents stay unchanged on failure.
+// The file is only rewritten when the modification reports a change.
+func (w *Wallet) update(modify func(contents *walletContents) (changed bool, err error)) error {
+	if w == nil {
+		return codedErrorf(ERROR_CODE_NOT_INITIALIZED, "The wallet has not been opened")
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	updated := *w.contents
+	updated.Credentials = append([]*WalletCredential{}, w.contents.Credentials...)
+
+	changed, err := modify(&updated)
+	if err != nil || !changed {
+		return err
+	}
+
+	return w.write(&updated)
+}
+
+func WalletSetHolderSk(holderSkJson []byte) *Result {
+	return getDefaultWallet().SetHolderSk(holderSkJson)
+}
+
+func (w *Wallet) SetHolderSk(holderSkJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if w == nil {
+		return walletNotOpenedResult()
+	}
+
+	// Make sure that the key is valid, before storing it
+	_, err := unmarshalHolderSk(holderSkJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	err = w.update(func(contents *walletContents) (bool, error) {
+		contents.HolderSk = holderSkJson
+		return true, nil
+	})
+	if err != nil {
+		return WrappedErrorResult(err, "Could not store holder secret key")
+	}
+
+	return &Result{nil, "", ""}
+}
+
+// WalletGetHolderSk returns the stored holder secret key JSON, which is empty when none is stored
+func WalletGetHolderSk() *Result {
+	return getDefaultWallet().GetHolderSk()
+}
+
+func (w *Wallet) GetHolderSk() (result *Result) {
+	defer recoverResult(&result)
+
+	if w == nil {
+		return walletNotOpenedResult()
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return &Result{w.contents.HolderSk, "", ""}
+}
+
+// WalletAddDomesticCredential stores a domestic credential JSON, of which the value of the result
+// is the identifier. Adding a credential that is already stored has no effect.
+func WalletAddDomesticCredential(credJson []byte) *Result {
+	return getDefaultWallet().AddDomesticCredential(credJson)
+}
+
+func (w *Wallet) AddDomesticCredential(credJson []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if w == nil {
+		return walletNotOpenedResult()
+	}
+
+	cred, err := unmarshalCredential(credJson)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	// Store the canonical JSON form, so that the same credential always has the same identifier
+	canonicalCredJson, err := json.Marshal(cred)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal credential")
+	}
+
+	attributes, err := readCredentialWithVersion(cred)
+	if err != nil {
+		return ErrorResult(err)
+	}
+
+	_, validUntil, err := domesticValidity(attributes["validFrom"], attributes["validForHours"])
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not read credential validity")
+	}
+
+	return w.addCredential(&WalletCredential{
+		Identifier: walletCredentialIdentifier(canonicalCredJson),
+		Type:       WALLET_CREDENTIAL_TYPE_DOMESTIC,
+		Credential: canonicalCredJson,
+		ValidUntil: validUntil.Unix(),
+	})
+}
+
+// WalletAddEuropeanCredential is the European counterpart of WalletAddDomesticCredential
+func WalletAddEuropeanCredential(proofPrefixed []byte) *Result {
+	return getDefaultWallet().AddEuropeanCredential(proofPrefixed)
+}
+
+func (w *Wallet) AddEuropeanCredential(proofPrefixed []byte) (result *Result) {
+	defer recoverResult(&result)
+
+	if w == nil {
+		return walletNotOpenedResult()
+	}
+
+	hcert, err := w.europeanHolder.ReadQREncoded(proofPrefixed)
+	if err != nil {
+		return WrappedErrorResult(withErrorCode(err, ERROR_CODE_MALFORMED_INPUT), "Could not read European credential")
+	}
+
+	// Specimen credentials don't expire
+	validUntil := hcert.ExpirationTime
+	if validUntil == HCERT_SPECIMEN_EXPIRATION_TIME {
+		validUntil = 0
+	}
+
+	return w.addCredential(&WalletCredential{
+		Identifier: walletCredentialIdentifier(proofPrefixed),
+		Type:       WALLET_CREDENTIAL_TYPE_EUROPEAN,
+		QR:         string(proofPrefixed),
+		ValidUntil: validUntil,
+	})
+}
+
+func (w *Wallet) addCredential(credential *WalletCredential) *Result {
+	err := w.update(func(contents *walletContents) (bool, error) {
+		for _, stored := range contents.Credentials {
+			if stored.Identifier == credential.Identifier {
+				return false, nil
+			}
+		}
+
+		if w.maxStoredCredentials != 0 && len(contents.Credentials) >= w.maxStoredCredentials {
+			return false, codedErrorf(ERROR_CODE_WALLET_FULL, "The wallet already stores the maximum of %d credentials", w.maxStoredCredentials)
+		}
+
+		contents.Credentials = append(contents.Credentials, credential)
+		return true, nil
+	})
+	if err != nil {
+		return WrappedErrorResult(err, "Could not store credential")
+	}
+
+	return &Result{[]byte(credential.Identifier), "", ""}
+}
+
+// WalletRemoveCredential removes the credential with the given identifier, if it is stored
+func WalletRemoveCredential(identifier string) *Result {
+	return getDefaultWallet().RemoveCredential(identifier)
+}
+
+func (w *Wallet) RemoveCredential(identifier string) (result *Result) {
+	defer recoverResult(&result)
+
+	err := w.update(func(contents *walletContents) (bool, error) {
+		credentialAmount := len(contents.Credentials)
+		contents.Credentials = filterWalletCredentials(contents.Credentials, func(credential *WalletCredential) bool {
+			return credential.Identifier != identifier
+		})
+
+		return len(contents.Credentials) != credentialAmount, nil
+	})
+	if err != nil {
+		return WrappedErrorResult(err, "Could not remove credential")
+	}
+
+	return &Result{nil, "", ""}
+}
+
+// WalletPruneExpired removes the credentials that have expired at the given unix time. The value
+// of the result is a JSON list of the identifiers of the removed credentials.
+func WalletPruneExpired(nowUnix int64) *Result {
+	return getDefaultWallet().PruneExpired(nowUnix)
+}
+
+func (w *Wallet) PruneExpired(nowUnix int64) (result *Result) {
+	defer recoverResult(&result)
+
+	removedIdentifiers := []string{}
+	err := w.update(func(contents *walletContents) (bool, error) {
+		contents.Credentials = filterWalletCredentials(contents.Credentials, func(credential *WalletCredential) bool {
+			isExpired := credential.ValidUntil != 0 && credential.ValidUntil <= nowUnix
+			if isExpired {
+				removedIdentifiers = append(removedIdentifiers, credential.Identifier)
+			}
+
+			return !isExpired
+		})
+
+		return len(removedIdentifiers) != 0, nil
+	})
+	if err != nil {
+		return WrappedErrorResult(err, "Could not prune expired credentials")
+	}
+
+	removedIdentifiersJson, err := json.Marshal(removedIdentifiers)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal removed identifiers")
+	}
+
+	return &Result{removedIdentifiersJson, "", ""}
+}
+
+// WalletListCredentials returns a JSON list of all stored credentials, in the order of adding
+func WalletListCredentials() *Result {
+	return getDefaultWallet().ListCredentials()
+}
+
+func (w *Wallet) ListCredentials() (result *Result) {
+	defer recoverResult(&result)
+
+	if w == nil {
+		return walletNotOpenedResult()
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	credentialsJson, err := json.Marshal(w.contents.Credentials)
+	if err != nil {
+		return WrappedErrorResult(err, "Could not JSON marshal credentials")
+	}
+
+	return &Result{credentialsJson, "", ""}
+}
+
+func walletNotOpenedResult() *Result {
+	return ErrorResult(codedErrorf(ERROR_CODE_NOT_INITIALIZED, "The wallet has not been opened"))
+}
+
+// walletCredentialIdentifier identifies a credential by the hash of its content, so that
+// the same credential is only stored once
+func walletCredentialIdentifier(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:16])
+}
+
+func filterWalletCredentials(credentials []*WalletCredential, keep func(credential *WalletCredential) bool) []*WalletCredential {
+	filtered := make([]*WalletCredential, 0, len(credentials))
+	for _, credential := range credentials {
+		if keep(credential) {
+			filtered = append(filtered, credential)
+		}
+	}
+
+	return filtered
+}
@@ -0,0 +1,164 @@
+package mobilecore
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWallet(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{0x42}, WALLET_KEY_SIZE)
+
+	w, err := NewWallet(dir, key, 2)
+	if err != nil {
+		t.Fatal("Could not create wallet", err)
+	}
+
+	r1 := GenerateHolderSk()
+	if r1.Error != "" {
+		t.Fatal("Could not generate holder secret key", r1.Error)
+	}
+
+	r2 := w.SetHolderSk(r1.Value)
+	if r2.Error != "" {
+		t.Fatal("Could not store holder secret key", r2.Error)
+	}
+
+	credsJson := issueTestCredentials(t, r1.Value, buildCredentialsAttributes(2))
+	r3 := w.AddDomesticCredential(credsJson[0])
+	if r3.Error != "" {
+		t.Fatal("Could not add domestic credential", r3.Error)
+	}
+
+	r4 := w.AddEuropeanCredential(defaultQR)
+	if r4.Error != "" {
+		t.Fatal("Could not add European credential", r4.Error)
+	}
+
+	// Adding a stored credential again has no effect, but the wallet is full for other credentials
+	r5 := w.AddEuropeanCredential(defaultQR)
+	if r5.Error != "" || string(r5.Value) != string(r4.Value) {
+		t.Fatal("Expected the same identifier when adding a credential again", r5.Error)
+	}
+
+	// The identifier doesn't depend on the formatting of the credential JSON
+	var indentedCredJson bytes.Buffer
+	err = json.Indent(&indentedCredJson, credsJson[0], "", "  ")
+	if err != nil {
+		t.Fatal("Could not indent credential JSON", err)
+	}
+
+	r16 := w.AddDomesticCredential(indentedCredJson.Bytes())
+	if r16.Error != "" || string(r16.Value) != string(r3.Value) {
+		t.Fatal("Expected the same identifier for a differently formatted credential", r16.Error)
+	}
+
+	r6 := w.AddDomesticCredential(credsJson[1])
+	if r6.ErrorCode != ERROR_CODE_WALLET_FULL {
+		t.Fatal("Expected a wallet full error, got", r6.ErrorCode)
+	}
+
+	// The file is encrypted, and can be read back with the same key only
+	fileJson, err := os.ReadFile(path.Join(dir, WALLET_FILENAME))
+	if err != nil {
+		t.Fatal("Could not read wallet file", err)
+	}
+
+	if bytes.Contains(fileJson, []byte("HC1:")) {
+		t.Fatal("Expected the wallet file to be encrypted")
+	}
+
+	w2, err := NewWallet(dir, key, 2)
+	if err != nil {
+		t.Fatal("Could not reopen wallet", err)
+	}
+
+	r7 := w2.GetHolderSk()
+	if r7.Error != "" || string(r7.Value) != string(r1.Value) {
+		t.Fatal("Expected the stored holder secret key", r7.Error)
+	}
+
+	var credentials []*WalletCredential
+	r8 := w2.ListCredentials()
+	err = json.Unmarshal(r8.Value, &credentials)
+	if err != nil || len(credentials) != 2 {
+		t.Fatal("Expected two stored credentials", r8.Error, err)
+	}
+
+	if credentials[0].Type != WALLET_CREDENTIAL_TYPE_DOMESTIC || credentials[1].QR != string(defaultQR) {
+		t.Fatal("Unexpected stored credentials")
+	}
+
+	_, err = NewWallet(dir, bytes.Repeat([]byte{0x43}, WALLET_KEY_SIZE), 0)
+	if getErrorCode(err) != ERROR_CODE_DECRYPTION_FAILED {
+		t.Fatal("Expected a decryption failure with another key, got", err)
+	}
+
+	_, err = NewWallet(dir, key[:16], 0)
+	if getErrorCode(err) != ERROR_CODE_MALFORMED_INPUT {
+		t.Fatal("Expected an error for a key of the wrong size, got", err)
+	}
+
+	// Pruning without expired credentials doesn't rewrite the file
+	r17 := w2.PruneExpired(0)
+	unchangedFileJson, err := os.ReadFile(path.Join(dir, WALLET_FILENAME))
+	if err != nil || r17.Error != "" || !bytes.Equal(unchangedFileJson, fileJson) {
+		t.Fatal("Expected the wallet file to be unchanged when nothing was pruned", r17.Error, err)
+	}
+
+	// Expired credentials are pruned
+	r9 := w2.PruneExpired(credentials[0].ValidUntil)
+	var removedIdentifiers []string
+	err = json.Unmarshal(r9.Value, &removedIdentifiers)
+	if err != nil || len(removedIdentifiers) != 1 || removedIdentifiers[0] != credentials[0].Identifier {
+		t.Fatal("Expected the domestic credential to be pruned", r9.Error, err)
+	}
+
+	r10 := w2.RemoveCredential(string(r4.Value))
+	if r10.Error != "" {
+		t.Fatal("Could not remove credential", r10.Error)
+	}
+
+	r11 := w2.ListCredentials()
+	if string(r11.Value) != "[]" {
+		t.Fatal("Expected an empty wallet, got", string(r11.Value))
+	}
+
+	// Unknown format versions are refused
+	fileJson, err = os.ReadFile(path.Join(dir, WALLET_FILENAME))
+	if err != nil {
+		t.Fatal("Could not read wallet file", err)
+	}
+
+	err = os.WriteFile(path.Join(dir, WALLET_FILENAME), []byte(strings.Replace(string(fileJson), `"version":1`, `"version":2`, 1)), 0600)
+	if err != nil {
+		t.Fatal("Could not write wallet file", err)
+	}
+
+	_, err = NewWallet(dir, key, 0)
+	if err == nil || !strings.Contains(err.Error(), "version 2") {
+		t.Fatal("Expected an unsupported version error", err)
+	}
+
+	// The default wallet
+	r12 := WalletListCredentials()
+	if r12.ErrorCode != ERROR_CODE_NOT_INITIALIZED {
+		t.Fatal("Expected a not initialized error without an opened wallet, got", r12.ErrorCode)
+	}
+
+	r13 := OpenWallet(t.TempDir(), key)
+	if r13.Error != "" {
+		t.Fatal("Could not open default wallet", r13.Error)
+	}
+
+	r14 := WalletAddEuropeanCredential(defaultQR)
+	r15 := WalletPruneExpired(time.Unix(1627462000, 0).Unix())
+	if r14.Error != "" || r15.Error != "" || string(r15.Value) != "[]" {
+		t.Fatal("Expected the European credential to remain in the default wallet", r14.Error, r15.Error)
+	}
+}